@@ -7,6 +7,17 @@
 // This application send logs to syslog. To read current log messages in
 // archlinux use `journalctl -f` command.
 //
+// The copy progress bar is shown in terminal, use -q flag to hide it. The
+// copy may be interrupted with Ctrl+C, the incomplete multipart upload of
+// target S3 object is aborted and incomplete target file is removed.
+//
+// The SHA256 checksum of uploaded file is stored in S3 object metadata, use
+// -checksum flag to select md5, sha256 or crc32c algorithm or none to skip
+// it. The stored checksum and size of S3 object are verified when it is
+// downloaded. The downloaded file is written to temporary file which is
+// synced and renamed to target file only after verification, the
+// application exits with non-zero status on mismatch.
+//
 // The S3 storage credentials may be set in application parameters or in
 // environment variables:
 //
@@ -15,9 +26,42 @@
 //	TEOS3_ENDPOINT
 //	TEOS3_BUCKET
 //
+// If access and secret keys are not set, they are taken from the credentials
+// chain: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables,
+// AWS shared credentials and config files profile (TEOS3_PROFILE or
+// AWS_PROFILE) and session token file (TEOS3_TOKENFILE).
+//
+// The S3 storage connection parameters may be also set in named profile of
+// the ~/.config/teos3/config.yaml config file and selected with -profile flag
+// or TEOS3_PROFILE environment variable. The profile parameters override
+// environment variables and flags set in command line override profile
+// parameters:
+//
+//	s3cp -profile staging file.txt s3:/folder/file.txt
+//
+// Use -r flag to copy local directory tree to S3 folder or S3 folder to local
+// directory, the files are copied in -j concurrent copies:
+//
+//	s3cp -r -j 32 photos s3:/backup/photos
+//
+// Several sources are copied into target directory or S3 folder (ending with
+// '/'). The S3 objects are copied to S3 on server side, use s3://bucket/key
+// to define S3 object in another bucket:
+//
+//	s3cp a.txt b.txt s3:docs/
+//	s3cp -r s3:docs s3://archive/docs
+//
+// Use '-' source or target to copy from standard input or to standard output,
+// so s3cp may be used in shell pipelines:
+//
+//	pg_dump db | gzip | s3cp -q - s3:backups/db.sql.gz
+//	s3cp -q s3:backups/db.sql.gz - | gunzip | psql db
+//
 // Parameter and arguments usage:
-// s3cp [OPTION] source target
+// s3cp [OPTION] source... target
 // use s3:/folder_and_object_name to define S3 in source or target
+// use s3://bucket/folder_and_object_name to define S3 in another bucket
+// use - to define standard input in source or standard output in target
 //
 // Usage of /tmp/go-build1982013444/b001/exe/s3cp:
 //
@@ -25,8 +69,17 @@
 //	   S3 storage Access key
 //	-bucket string
 //	   S3 storage Bucket
+//	-checksum string
+//	   checksum algorithm of uploaded files: md5, sha256, crc32c or none
+//	   (default "sha256")
 //	-endpoint string
 //	   S3 storage Endpoint
+//	-j int
+//	   number of concurrent file copies in recursive copy (default 16)
+//	-profile string
+//	   config file profile
+//	-q	quiet mode, do not show progress bar
+//	-r	copy directory to S3 folder or S3 folder to directory recursively
 //	-secretkey string
 //	   S3 storage Secret key
 //	-secure
@@ -34,13 +87,19 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"log/syslog"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/teonet-go/teos3"
+	"github.com/teonet-go/teos3/internal/cli"
 )
 
 // Application constants
@@ -49,20 +108,15 @@ const (
 	appVersion = teos3.Version
 )
 
-// S3 access variables
-var (
-	accessKey = os.Getenv("TEOS3_ACCESSKEY")
-	secretKey = os.Getenv("TEOS3_SECRETKEY")
-	endpoint  = os.Getenv("TEOS3_ENDPOINT")
-	bucket    = os.Getenv("TEOS3_BUCKET")
-	secure    = true
-)
-
 // Application usage message
 const (
 	about = "Teonet " + appName + " application ver " + appVersion + "\n"
-	usage = "s3cp [OPTION] source target\n" +
-		"use s3:/folder_and_object_name to define S3 in source or target\n"
+	usage = "s3cp [OPTION] source... target\n" +
+		"use s3:/folder_and_object_name to define S3 in source or target\n" +
+		"use s3://bucket/folder_and_object_name to define S3 in another " +
+		"bucket\n" +
+		"use - to define standard input in source or standard output in " +
+		"target\n"
 )
 
 func main() {
@@ -76,11 +130,14 @@ func main() {
 	log.SetOutput(sysLog)
 
 	// Application parameters
-	flag.StringVar(&accessKey, "accesskey", accessKey, "S3 storage Access key")
-	flag.StringVar(&secretKey, "secretkey", secretKey, "S3 storage Secret key")
-	flag.StringVar(&endpoint, "endpoint", endpoint, "S3 storage Endpoint")
-	flag.StringVar(&bucket, "bucket", bucket, "S3 storage Bucket")
-	flag.BoolVar(&secure, "secure", secure, "set secure=false to enable insecure (HTTP) access")
+	flags := teos3.NewFlags(nil)
+	quiet := flag.Bool("q", false, "quiet mode, do not show progress bar")
+	recursive := flag.Bool("r", false,
+		"copy directory to S3 folder or S3 folder to directory recursively")
+	workers := flag.Int("j", teos3.DefaultWorkers,
+		"number of concurrent file copies in recursive copy")
+	checksum := flag.String("checksum", "sha256",
+		"checksum algorithm of uploaded files: md5, sha256, crc32c or none")
 
 	// Define new flag usage function and parse flag
 	flagUsage := flag.Usage
@@ -91,20 +148,62 @@ func main() {
 	}
 	flag.Parse()
 
-	// Check parameters
-	if len(accessKey) == 0 || len(secretKey) == 0 || len(endpoint) == 0 {
-		fmt.Print("Parameters -accesskey, -secretkey and -endpoint should be set\n")
+	// Check arguments
+	args := flag.Args()
+	if len(args) < 2 {
 		flag.Usage()
 		os.Exit(0)
 	}
+	var alg teos3.ChecksumAlgorithm
+	if *checksum != "none" {
+		if alg, err = teos3.ParseChecksumAlgorithm(*checksum); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 
-	// Check arguments
-	args := flag.Args()
-	if len(args) < 2 {
+	// Connect to S3 storage
+	con, err := flags.Connect()
+	if errors.Is(err, teos3.ErrEndpointNotSet) {
+		fmt.Print("Parameter -endpoint or -profile should be set\n")
 		flag.Usage()
 		os.Exit(0)
 	}
-	log.Println("copy", args[0], "to", args[1])
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	log.Println("copy", strings.Join(args[:len(args)-1], " "), "to",
+		args[len(args)-1])
 
-	teos3.Copy(accessKey, secretKey, endpoint, bucket, args, secure)
+	// Cancel copy on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+
+	// Copy options and progress bar in terminal
+	opt := &teos3.CopyWithOptions{
+		Context:   ctx,
+		Recursive: *recursive,
+		Workers:   *workers,
+		Checksum:  alg,
+	}
+	showBar := !*quiet && cli.IsTerminal(os.Stderr)
+	if showBar {
+		opt.Progress = cli.ProgressBar(os.Stderr)
+	}
+
+	err = teos3.CopyWith(con, args, opt)
+	if err == nil {
+		return
+	}
+	if showBar {
+		fmt.Fprintln(os.Stderr)
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted")
+		os.Exit(130)
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
 }
@@ -0,0 +1,190 @@
+// Copyright 2022-23 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The s3sync application synchronizes local directory and S3 folder.
+//
+// This application send logs to syslog. To read current log messages in
+// archlinux use `journalctl -f` command.
+//
+// Only new and changed files are copied from source to target. The file is
+// changed if it has different size or modification time, use -checksum flag
+// to compare files with different modification time by MD5, the equal files
+// get the same modification time and are not compared again. Use -delete flag
+// to remove target files which do not exist in source:
+//
+//	s3sync -delete photos s3:/backup/photos
+//	s3sync s3:/backup/photos photos
+//
+// Use -two-way flag to copy changes of both sides. The state of last sync is
+// saved to .teos3sync file of local directory. The file changed on both sides
+// is reported as conflict and is not copied, the application exits with
+// non-zero status. With -delete flag the file removed on one side is removed
+// on other side:
+//
+//	s3sync -two-way -delete notes s3:/notes
+//
+// Use repeatable -include and -exclude flags to select synchronized files by
+// glob pattern, and -dry-run flag to print actions without executing them:
+//
+//	s3sync -dry-run -exclude '*.tmp' -exclude .git photos s3:/backup/photos
+//
+// The S3 storage credentials and connection parameters may be set the same
+// way as in s3cp application.
+//
+// Parameter and arguments usage:
+// s3sync [OPTION] source target
+// use s3:/folder_name to define S3 folder in source or target
+// use s3://bucket/folder_name to define S3 folder in another bucket
+//
+// Usage of s3sync:
+//
+//	-accesskey string
+//	   S3 storage Access key
+//	-bucket string
+//	   S3 storage Bucket
+//	-checksum
+//	   compare files with different modification time by MD5
+//	-delete
+//	   remove target files which do not exist in source
+//	-dry-run
+//	   print actions without executing them
+//	-endpoint string
+//	   S3 storage Endpoint
+//	-exclude value
+//	   skip files matching glob pattern, may be repeated
+//	-include value
+//	   synchronize only files matching glob pattern, may be repeated
+//	-j int
+//	   number of concurrent file copies and removes (default 16)
+//	-profile string
+//	   config file profile
+//	-q	quiet mode, do not show progress bar and actions
+//	-secretkey string
+//	   S3 storage Secret key
+//	-secure
+//	   set secure=false to enable insecure (HTTP) access (default true)
+//	-two-way
+//	   synchronize changes of both sides
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"log/syslog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/teonet-go/teos3"
+	"github.com/teonet-go/teos3/internal/cli"
+)
+
+// Application constants
+const (
+	appName    = "s3sync"
+	appVersion = teos3.Version
+)
+
+// Application usage message
+const (
+	about = "Teonet " + appName + " application ver " + appVersion + "\n"
+	usage = "s3sync [OPTION] source target\n" +
+		"use s3:/folder_name to define S3 folder in source or target\n" +
+		"use s3://bucket/folder_name to define S3 folder in another bucket\n"
+)
+
+func main() {
+
+	// Set log otput to syslog
+	sysLog, err := syslog.New(syslog.LOG_INFO|syslog.LOG_LOCAL7, appName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	log.SetFlags(log.Flags() &^ (log.Ldate | log.Ltime))
+	log.SetOutput(sysLog)
+
+	// Application parameters
+	flags := teos3.NewFlags(nil)
+	opt := &teos3.SyncOptions{}
+	flag.BoolVar(&opt.Delete, "delete", false,
+		"remove target files which do not exist in source")
+	flag.BoolVar(&opt.DryRun, "dry-run", false,
+		"print actions without executing them")
+	flag.BoolVar(&opt.TwoWay, "two-way", false,
+		"synchronize changes of both sides")
+	flag.BoolVar(&opt.Checksum, "checksum", false,
+		"compare files with different modification time by MD5")
+	flag.Func("include",
+		"synchronize only files matching glob pattern, may be repeated",
+		func(s string) error { opt.Include = append(opt.Include, s); return nil })
+	flag.Func("exclude", "skip files matching glob pattern, may be repeated",
+		func(s string) error { opt.Exclude = append(opt.Exclude, s); return nil })
+	flag.IntVar(&opt.Workers, "j", teos3.DefaultWorkers,
+		"number of concurrent file copies and removes")
+	quiet := flag.Bool("q", false,
+		"quiet mode, do not show progress bar and actions")
+
+	// Define new flag usage function and parse flag
+	flagUsage := flag.Usage
+	flag.Usage = func() {
+		fmt.Print(about + "\n" + usage + "\n")
+		flagUsage()
+		fmt.Println()
+	}
+	flag.Parse()
+
+	// Check arguments
+	args := flag.Args()
+	if len(args) != 2 {
+		flag.Usage()
+		os.Exit(0)
+	}
+
+	// Connect to S3 storage
+	con, err := flags.Connect()
+	if errors.Is(err, teos3.ErrEndpointNotSet) {
+		fmt.Print("Parameter -endpoint or -profile should be set\n")
+		flag.Usage()
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	log.Println("sync", args[0], "to", args[1])
+
+	// Cancel sync on interrupt
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt,
+		syscall.SIGTERM)
+	defer stop()
+	opt.Context = ctx
+
+	// Print actions and show progress bar in terminal
+	showBar := !*quiet && !opt.DryRun && cli.IsTerminal(os.Stderr)
+	if !*quiet || opt.DryRun {
+		opt.Action = func(a teos3.SyncAction) {
+			fmt.Printf("%s: %s\n", a.Op, a.Name)
+		}
+	}
+	if showBar {
+		opt.Progress = cli.ProgressBar(os.Stderr)
+	}
+
+	err = teos3.Sync(con, args[0], args[1], opt)
+	if err == nil {
+		return
+	}
+	if showBar {
+		fmt.Fprintln(os.Stderr)
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintln(os.Stderr, "interrupted")
+		os.Exit(130)
+	}
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
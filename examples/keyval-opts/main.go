@@ -27,10 +27,10 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
-	"os"
 	"sync"
 	"time"
 
@@ -42,42 +42,30 @@ const (
 	appVersion = teos3.Version
 )
 
-var (
-	accessKey = os.Getenv("TEOS3_ACCESSKEY")
-	secretKey = os.Getenv("TEOS3_SECRETKEY")
-	endpoint  = os.Getenv("TEOS3_ENDPOINT")
-	bucket    = os.Getenv("TEOS3_BUCKET")
-	secure    = true
-)
-
 func main() {
 
 	// Application logo
 	fmt.Println(appName + " ver " + appVersion)
 
 	// Application parameters
-	flag.StringVar(&accessKey, "accesskey", accessKey, "S3 storage Access key")
-	flag.StringVar(&secretKey, "secretkey", secretKey, "S3 storage Secret key")
-	flag.StringVar(&endpoint, "endpoint", endpoint, "S3 storage Endpoint")
-	flag.StringVar(&bucket, "bucket", bucket, "S3 storage Bucket")
-	flag.BoolVar(&secure, "secure", secure, "set secure=false to enable insecure (HTTP) access")
+	flags := teos3.NewFlags(nil)
 
 	flag.Parse()
-	if len(accessKey) == 0 || len(secretKey) == 0 || len(endpoint) == 0 {
-		fmt.Println("The accesskey, secretkey and endpoint is requered parameters.")
-		flag.Usage()
-		return
-	}
 
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 	start := time.Now()
 
 	// Connect to teonet S3 storage
-	log.Println("Connect to", endpoint)
-	con, err := teos3.Connect(accessKey, secretKey, endpoint, secure, bucket)
+	con, err := flags.Connect()
+	if errors.Is(err, teos3.ErrEndpointNotSet) {
+		fmt.Println("The endpoint or profile is requered parameter.")
+		flag.Usage()
+		return
+	}
 	if err != nil {
 		log.Fatalln(err)
 	}
+	log.Println("Connected to S3 storage")
 
 	// Set some key/value records to the S3 storage asynchronously
 	const num = 10
@@ -7,10 +7,14 @@
 // used in this example:
 //
 //	go run ./cmd/s3cp/ --bucket=tst ./examples/smpl/teotun.jpeg s3:/teotun.jpeg
+//
+// and run this example with the same bucket:
+//
+//	go run ./examples/smpl/ --bucket=tst
 package main
 
 import (
-	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -19,9 +23,6 @@ import (
 	"time"
 
 	"github.com/teonet-go/teos3"
-
-	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
 const (
@@ -29,17 +30,7 @@ const (
 	appVersion = teos3.Version
 )
 
-const (
-	bucket = "tst"
-	object = "teotun.jpeg"
-)
-
-var (
-	accessKey = os.Getenv("TEOS3_ACCESSKEY")
-	secretKey = os.Getenv("TEOS3_SECRETKEY")
-	endpoint  = os.Getenv("TEOS3_ENDPOINT")
-	secure    = true
-)
+const object = "teotun.jpeg"
 
 func main() {
 
@@ -47,56 +38,35 @@ func main() {
 	fmt.Println(appName + " ver " + appVersion)
 
 	// Application parameters
-	flag.StringVar(&accessKey, "accesskey", accessKey, "S3 storage Access key")
-	flag.StringVar(&secretKey, "secretkey", secretKey, "S3 storage Secret key")
-	flag.StringVar(&endpoint, "endpoint", endpoint, "S3 storage Endpoint")
-	flag.BoolVar(&secure, "secure", secure, "set secure=false to enable insecure (HTTP) access")
-
+	flags := teos3.NewFlags(nil)
 	flag.Parse()
-	if len(accessKey) == 0 || len(secretKey) == 0 || len(endpoint) == 0 {
-		fmt.Println("The accesskey, secretkey and endpoint is requered parameters.")
-		flag.Usage()
-		return
-	}
 
 	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 	start := time.Now()
 
-	// Requests are always secure (HTTPS) by default. Set secure=false to enable
-	// insecure (HTTP) access. This boolean value is the last argument for New().
-	//
-	// New returns an Amazon S3 compatible client object. API compatibility
-	// (v2 or v4) is automatically determined based on the Endpoint value.
-	log.Println("Connecting to", endpoint, "secure", secure)
-	s3Client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: secure,
-	})
+	// Connect to S3 storage. Requests are always secure (HTTPS) by default.
+	// Set secure=false to enable insecure (HTTP) access.
+	log.Println("Connecting to S3 storage")
+	con, err := flags.Connect()
+	if errors.Is(err, teos3.ErrEndpointNotSet) {
+		fmt.Println("The endpoint or profile is requered parameter.")
+		flag.Usage()
+		return
+	}
 	if err != nil {
 		log.Fatalln(err)
 	}
 
-	// Check bucket exists
+	// Create bucket if it does not exists
+	bucket := con.Bucket()
 	log.Println("Check bucket", bucket, "exists")
-	found, err := s3Client.BucketExists(context.Background(), bucket)
-	if err != nil {
+	if err = con.EnsureBucket(); err != nil {
 		log.Fatalln(err)
 	}
-	if !found {
-		log.Println("Create bucket", bucket)
-		err = s3Client.MakeBucket(context.Background(), bucket,
-			minio.MakeBucketOptions{},
-		)
-		if err != nil {
-			log.Fatalln(err)
-		}
-	}
 
 	// Get object
 	log.Println("Get S3 bucket:", bucket, "object:", object)
-	reader, err := s3Client.GetObject(context.Background(), bucket, object,
-		minio.GetObjectOptions{},
-	)
+	reader, err := con.GetObject(object)
 	if err != nil {
 		log.Fatalln(err)
 	}
@@ -125,25 +95,28 @@ func main() {
 
 	// Put file to S3
 	log.Println("Put file to S3")
-	s3Client.FPutObject(context.Background(), bucket, object+"(2)", object,
-		minio.PutObjectOptions{
+	if _, err = localFile.Seek(0, io.SeekStart); err != nil {
+		log.Fatalln(err)
+	}
+	err = con.SetObject(object+"(2)", localFile, stat.Size, &teos3.SetOptions{
+		SetObjectOptions: teos3.SetObjectOptions{
 			ContentType: stat.ContentType,
 		},
-	)
+	})
+	if err != nil {
+		log.Fatalln(err)
+	}
 
-	// List all objects from a bucket-name with a matching prefix.
+	// List all objects from a bucket recursively
 	log.Println("List all objects from", bucket)
-	for object := range s3Client.ListObjects(context.Background(), bucket,
-		minio.ListObjectsOptions{
-			UseV1: true,
-			// Prefix:    "my-prefixname",
-			Recursive: true,
-		}) {
-		if object.Err != nil {
-			fmt.Println(" ", object.Err)
+	for key, err := range con.Keys("", &teos3.ListOptions{
+		ListObjectsOptions: teos3.ListObjectsOptions{Recursive: true},
+	}) {
+		if err != nil {
+			fmt.Println(" ", err)
 			return
 		}
-		fmt.Println(" ", object.Key)
+		fmt.Println(" ", key)
 	}
 
 	log.Println("All done", time.Since(start))
@@ -0,0 +1,13 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3
+
+// SetComposeObjectSize sets minimum size of source object copied by
+// ComposeObject and returns function which restores it.
+func SetComposeObjectSize(size int64) (restore func()) {
+	prev := composeObjectSize
+	composeObjectSize = size
+	return func() { composeObjectSize = prev }
+}
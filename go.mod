@@ -2,7 +2,10 @@ module github.com/teonet-go/teos3
 
 go 1.25.7
 
-require github.com/minio/minio-go/v7 v7.0.98
+require (
+	github.com/minio/minio-go/v7 v7.0.98
+	go.yaml.in/yaml/v3 v3.0.4
+)
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
@@ -18,7 +21,6 @@ require (
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	github.com/rs/xid v1.6.0 // indirect
 	github.com/tinylib/msgp v1.6.1 // indirect
-	go.yaml.in/yaml/v3 v3.0.4 // indirect
 	golang.org/x/crypto v0.46.0 // indirect
 	golang.org/x/net v0.48.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
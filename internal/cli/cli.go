@@ -0,0 +1,68 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// Package cli contains terminal helpers of teos3 applications: progress bar
+// and human readable sizes.
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/teonet-go/teos3"
+)
+
+// IsTerminal returns true if file is terminal.
+func IsTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ProgressBar returns progress function which draws progress bar of copied
+// source to terminal w.
+func ProgressBar(w io.Writer) teos3.ProgressFunc {
+	const width = 30
+	return func(p teos3.Progress) {
+
+		// Bar, percent and size
+		var line string
+		if p.Total > 0 {
+			percent := min(p.Done*100/p.Total, 100)
+			fill := int(percent) * width / 100
+			line = fmt.Sprintf("[%-*s] %3d%% %s / %s", width,
+				strings.Repeat("=", fill), percent, HumanSize(p.Done),
+				HumanSize(p.Total))
+		} else {
+			line = HumanSize(p.Done)
+		}
+
+		// Rate and ETA
+		line += fmt.Sprintf("  %s/s", HumanSize(int64(p.Rate)))
+		if p.ETA > 0 {
+			line += "  ETA " + p.ETA.Round(time.Second).String()
+		}
+
+		fmt.Fprintf(w, "\r%s %s\033[K", p.Source, line)
+		if p.Finished {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// HumanSize returns size in bytes formatted with binary unit prefix.
+func HumanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,193 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package backend module.
+
+package teos3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Backend is the storage interface the TeoS3 methods are written against.
+// The minio S3 client is the default Backend created by Connect. Backend
+// methods use minio-go types and signatures, so any S3 compatible client or
+// storage may be wrapped to a Backend and used with ConnectBackend.
+type Backend interface {
+
+	// PutObject saves object from reader to the bucket by key.
+	PutObject(ctx context.Context, bucket, key string, reader io.Reader,
+		objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+
+	// GetObject returns object from the bucket by key.
+	GetObject(ctx context.Context, bucket, key string,
+		opts minio.GetObjectOptions) (Object, error)
+
+	// StatObject returns metadata of object from the bucket by key.
+	StatObject(ctx context.Context, bucket, key string,
+		opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+
+	// RemoveObject removes object from the bucket by key.
+	RemoveObject(ctx context.Context, bucket, key string,
+		opts minio.RemoveObjectOptions) error
+
+	// RemoveObjects removes objects received from objectsCh channel from the
+	// bucket. Objects which were not removed are returned in the errors
+	// channel. The errors channel is closed after objectsCh channel closed
+	// and all objects processed.
+	RemoveObjects(ctx context.Context, bucket string,
+		objectsCh <-chan minio.ObjectInfo,
+		opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError
+
+	// ListObjects lists objects of the bucket. Listing errors are returned
+	// in the Err field of the channel values.
+	ListObjects(ctx context.Context, bucket string,
+		opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+
+	// CopyObject copies source object to destination object.
+	CopyObject(ctx context.Context, dst minio.CopyDestOptions,
+		src minio.CopySrcOptions) (minio.UploadInfo, error)
+
+	// BucketExists returns true if the bucket exists.
+	BucketExists(ctx context.Context, bucket string) (bool, error)
+
+	// MakeBucket creates new bucket.
+	MakeBucket(ctx context.Context, bucket string,
+		opts minio.MakeBucketOptions) error
+
+	// RemoveBucket removes empty bucket.
+	RemoveBucket(ctx context.Context, bucket string) error
+
+	// ListBuckets returns list of all buckets.
+	ListBuckets(ctx context.Context) ([]minio.BucketInfo, error)
+}
+
+// ConditionalCopier is optional Backend interface of backends which check
+// destination object preconditions of CopyObject atomically. The ifMatch is
+// ETag (or "*") the destination object must match, the ifNoneMatch is ETag
+// (or "*") the destination object must not match. Empty preconditions are
+// not checked. The PreconditionFailed error is returned if precondition
+// does not hold.
+type ConditionalCopier interface {
+	CopyObjectIf(ctx context.Context, dst minio.CopyDestOptions,
+		src minio.CopySrcOptions, ifMatch, ifNoneMatch string) (
+		minio.UploadInfo, error)
+}
+
+// Composer is optional Backend interface of backends which create object
+// from ranged parts of source objects on server side. It is used to copy
+// objects larger than 5 GiB which can not be copied by one CopyObject
+// request.
+type Composer interface {
+	ComposeObject(ctx context.Context, dst minio.CopyDestOptions,
+		srcs ...minio.CopySrcOptions) (minio.UploadInfo, error)
+}
+
+// UploadRemover is optional Backend interface of backends which keep parts
+// of incomplete multipart uploads. It is used to abort multipart uploads of
+// object when SetObject is canceled, so the uploaded parts are not left in
+// the bucket.
+type UploadRemover interface {
+	RemoveIncompleteUpload(ctx context.Context, bucket, key string) error
+}
+
+// uploadAbortTimeout is the timeout of aborting incomplete multipart uploads
+// of canceled SetObject.
+const uploadAbortTimeout = 30 * time.Second
+
+// Large objects copy parameters
+const (
+	// maxCopyObjectSize is the maximum size of object copied by one
+	// CopyObject request.
+	maxCopyObjectSize = 5 << 30
+
+	// copyPartSize is the part size of large objects copied by
+	// ComposeObject. The 10000 parts of this size contain maximum 5 TiB
+	// object.
+	copyPartSize = 1 << 30
+)
+
+// composeObjectSize is the minimum size of source object copied by
+// ComposeObject. It is variable to test large objects copy on small objects.
+var composeObjectSize int64 = maxCopyObjectSize + 1
+
+// Object is an object returned by GetObject. The Object must be closed with
+// Close after use.
+type Object interface {
+	io.ReadSeekCloser
+	io.ReaderAt
+	Stat() (minio.ObjectInfo, error)
+}
+
+// NewMinioBackend creates Backend from minio S3 client.
+func NewMinioBackend(client *minio.Client) Backend {
+	return &minioBackend{client}
+}
+
+// minioBackend is Backend based on minio S3 client.
+type minioBackend struct {
+	*minio.Client
+}
+
+// GetObject returns object from the bucket by key.
+func (b *minioBackend) GetObject(ctx context.Context, bucket, key string,
+	opts minio.GetObjectOptions) (Object, error) {
+
+	obj, err := b.Client.GetObject(ctx, bucket, key, opts)
+	if err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// CopyObjectIf copies source object to destination object if destination
+// object preconditions hold. The preconditions are sent in If-Match and
+// If-None-Match headers of the copy request.
+func (b *minioBackend) CopyObjectIf(ctx context.Context,
+	dst minio.CopyDestOptions, src minio.CopySrcOptions, ifMatch,
+	ifNoneMatch string) (info minio.UploadInfo, err error) {
+
+	if ifMatch == "" && ifNoneMatch == "" {
+		return b.CopyObject(ctx, dst, src)
+	}
+
+	// Create copy request headers
+	header := make(http.Header)
+	dst.Marshal(header)
+	src.Marshal(header)
+	if ifMatch != "" {
+		header.Set("If-Match", quoteETag(ifMatch))
+	}
+	if ifNoneMatch != "" {
+		header.Set("If-None-Match", quoteETag(ifNoneMatch))
+	}
+	metadata := make(map[string]string, len(header))
+	for k := range header {
+		metadata[k] = header.Get(k)
+	}
+
+	objInfo, err := minio.Core{Client: b.Client}.CopyObject(ctx, src.Bucket,
+		src.Object, dst.Bucket, dst.Object, metadata, src,
+		minio.PutObjectOptions{})
+	if err != nil {
+		return
+	}
+
+	info = uploadInfo(dst.Bucket, objInfo)
+	return
+}
+
+// quoteETag returns quoted ETag, the "*" is not quoted.
+func quoteETag(etag string) string {
+	if etag == "*" {
+		return etag
+	}
+	return `"` + strings.Trim(etag, `"`) + `"`
+}
@@ -0,0 +1,113 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package bucket module.
+
+package teos3
+
+import (
+	"context"
+	"errors"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// BucketOptions contains context.Context and options for bucket requests.
+type BucketOptions struct {
+	context.Context
+	MakeBucketOptions
+}
+type MakeBucketOptions minio.MakeBucketOptions
+
+// NewBucketOptions creates a new BucketOptions object
+func (m *TeoS3) NewBucketOptions() *BucketOptions { return &BucketOptions{} }
+
+// getBucketOptions returns BucketOptions created from input options arguments.
+func (m *TeoS3) getBucketOptions(options ...*BucketOptions) (
+	opt *BucketOptions) {
+
+	opt = &BucketOptions{}
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
+	}
+
+	if opt.Context == nil {
+		opt.Context = m.context
+	}
+
+	return
+}
+
+// Bucket returns TeoS3 bucket name.
+func (m *TeoS3) Bucket() string { return m.bucket }
+
+// BucketExists returns true if TeoS3 bucket exists.
+func (m *TeoS3) BucketExists(options ...*BucketOptions) (bool, error) {
+
+	// Set options
+	opt := m.getBucketOptions(options...)
+
+	ok, err := m.con.BucketExists(opt.Context, m.bucket)
+	return ok, wrapError(err)
+}
+
+// EnsureBucket creates TeoS3 bucket if it does not exist. The options
+// parameter may be omitted and than bucket is created in default region.
+func (m *TeoS3) EnsureBucket(options ...*BucketOptions) (err error) {
+
+	// Set options
+	opt := m.getBucketOptions(options...)
+
+	ok, err := m.BucketExists(opt)
+	if err != nil || ok {
+		return
+	}
+
+	err = wrapError(m.con.MakeBucket(opt.Context, m.bucket,
+		minio.MakeBucketOptions(opt.MakeBucketOptions)))
+
+	// The bucket may be created by another client after exists check
+	if errors.Is(err, ErrBucketExists) {
+		err = nil
+	}
+	return
+}
+
+// DropBucket removes TeoS3 bucket. The not empty bucket is not removed and
+// ErrBucketNotEmpty is returned if force is false. If force is true then all
+// bucket objects are removed by RemoveObjects batches before removing the
+// bucket.
+// The prefix view removes only keys of its prefix, so the bucket is removed
+// only if it does not contain other keys.
+func (m *TeoS3) DropBucket(force bool, options ...*BucketOptions) (err error) {
+
+	// Set options
+	opt := m.getBucketOptions(options...)
+
+	// Remove all bucket objects
+	if force {
+		sum := new(summary)
+		delOpt := m.getDelOptions(&DelOptions{Context: opt.Context})
+		err = sum.result(nil, m.removeAll("", delOpt, sum))
+		if err != nil {
+			return
+		}
+	}
+
+	err = wrapError(m.con.RemoveBucket(opt.Context, m.bucket))
+	return
+}
+
+// ListBuckets returns list of all buckets available with TeoS3 connection
+// credentials.
+func (m *TeoS3) ListBuckets(options ...*BucketOptions) (
+	buckets []minio.BucketInfo, err error) {
+
+	// Set options
+	opt := m.getBucketOptions(options...)
+
+	buckets, err = m.con.ListBuckets(opt.Context)
+	err = wrapError(err)
+	return
+}
@@ -0,0 +1,251 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package checksum module.
+
+package teos3
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ChecksumAlgorithm is the algorithm of object checksum which is calculated
+// while object is uploaded and stored in object user metadata.
+type ChecksumAlgorithm string
+
+// Checksum algorithms
+const (
+	ChecksumMD5    ChecksumAlgorithm = "MD5"
+	ChecksumSHA256 ChecksumAlgorithm = "SHA256"
+	ChecksumCRC32C ChecksumAlgorithm = "CRC32C"
+)
+
+// ChecksumMetaKey is the object user metadata key which contains object
+// checksum in 'ALGORITHM:hex' format, f.e. 'SHA256:9f86d0...'. It is sent
+// in 'X-Amz-Meta-Teos3-Checksum' header.
+const ChecksumMetaKey = "Teos3-Checksum"
+
+// ParseChecksumAlgorithm returns checksum algorithm by its case insensitive
+// name.
+func ParseChecksumAlgorithm(name string) (alg ChecksumAlgorithm, err error) {
+	alg = ChecksumAlgorithm(strings.ToUpper(name))
+	if _, err = alg.hash(); err != nil {
+		return "", err
+	}
+	return
+}
+
+// hash returns new hash of checksum algorithm.
+func (alg ChecksumAlgorithm) hash() (hash.Hash, error) {
+	switch alg {
+	case ChecksumMD5:
+		return md5.New(), nil
+	case ChecksumSHA256:
+		return sha256.New(), nil
+	case ChecksumCRC32C:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+	}
+	return nil, fmt.Errorf("wrong checksum algorithm %q", string(alg))
+}
+
+// checksumReader is reader which calculates checksum of read data.
+type checksumReader struct {
+	io.Reader
+	alg  ChecksumAlgorithm
+	hash hash.Hash
+	n    int64 // Number of read bytes
+}
+
+// newChecksumReader creates reader which calculates checksum of reader data
+// by algorithm alg.
+func newChecksumReader(reader io.Reader, alg ChecksumAlgorithm) (
+	r *checksumReader, err error) {
+
+	h, err := alg.hash()
+	if err != nil {
+		return
+	}
+	return &checksumReader{Reader: reader, alg: alg, hash: h}, nil
+}
+
+// Read reads data from reader and adds it to checksum.
+func (r *checksumReader) Read(b []byte) (n int, err error) {
+	n, err = r.Reader.Read(b)
+	r.hash.Write(b[:n])
+	r.n += int64(n)
+	return
+}
+
+// checksum returns checksum of read data in metadata format.
+func (r *checksumReader) checksum() string {
+	return formatChecksum(r.alg, hex.EncodeToString(r.hash.Sum(nil)))
+}
+
+// formatChecksum returns checksum in metadata format.
+func formatChecksum(alg ChecksumAlgorithm, sum string) string {
+	return string(alg) + ":" + sum
+}
+
+// objectChecksum returns checksum stored in object user metadata or empty
+// string if object has no checksum. The value without known algorithm prefix
+// is not a checksum.
+func objectChecksum(info minio.ObjectInfo) string {
+	sum := info.UserMetadata[ChecksumMetaKey]
+	alg, _, _ := strings.Cut(sum, ":")
+	if _, err := ChecksumAlgorithm(alg).hash(); err != nil {
+		return ""
+	}
+	return sum
+}
+
+// verifyReader returns checksum reader of object info stored checksum
+// algorithm or nil if object has no checksum of known algorithm.
+func verifyReader(reader io.Reader, info minio.ObjectInfo) (
+	r *checksumReader, err error) {
+
+	sum := objectChecksum(info)
+	if sum == "" {
+		return
+	}
+	alg, _, _ := strings.Cut(sum, ":")
+	return newChecksumReader(reader, ChecksumAlgorithm(alg))
+}
+
+// verify returns ErrChecksumMismatch if read data checksum differs from
+// stored checksum sum. The nil reader is not verified.
+func (r *checksumReader) verify(name, sum string) error {
+	if r == nil {
+		return nil
+	}
+	if got := r.checksum(); !strings.EqualFold(got, sum) {
+		return fmt.Errorf("%s: %w: got %s, want %s", name, ErrChecksumMismatch,
+			got, sum)
+	}
+	return nil
+}
+
+// uploadReader is checksum reader of uploaded object data. If sum is set,
+// the checksum of read data is verified before the last data of object is
+// returned, so the upload of changed data fails before object is committed.
+// Otherwise the reader fails if more than maxCopyObjectSize bytes read, as
+// checksum of such object can not be set by server side copy.
+type uploadReader struct {
+	*checksumReader
+	name     string // Object name
+	size     int64  // Object size or -1 if unknown
+	sum      string // Expected checksum
+	verified bool
+}
+
+// Read reads data from reader and verifies checksum at the end of data.
+func (r *uploadReader) Read(b []byte) (n int, err error) {
+	n, err = r.checksumReader.Read(b)
+	switch {
+	case r.sum == "" && r.n > maxCopyObjectSize:
+		return 0, errChecksumSize
+	case r.sum == "" || r.verified:
+	case err == io.EOF || r.size >= 0 && r.n >= r.size:
+		r.verified = true
+		if e := r.verify(r.name, r.sum); e != nil {
+			return 0, e
+		}
+	}
+	return
+}
+
+// errChecksumSize is returned if checksum of not seekable reader can not be
+// stored because of object size.
+var errChecksumSize = fmt.Errorf("checksum of not seekable reader larger "+
+	"than %d bytes can not be stored", maxCopyObjectSize)
+
+// fileChecksum returns hex encoded checksum of first size bytes of file by
+// algorithm alg, the whole file is used if size is negative.
+func fileChecksum(name string, size int64, alg ChecksumAlgorithm) (
+	sum string, err error) {
+
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	r, err := newChecksumReader(limitReader(f, size), alg)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(io.Discard, r); err != nil {
+		return
+	}
+	return hex.EncodeToString(r.hash.Sum(nil)), nil
+}
+
+// seekerChecksum returns checksum of first size bytes of seeker data from
+// current position in metadata format and seeks back to this position. The
+// data to the end of seeker is used if size is negative.
+func seekerChecksum(seeker io.ReadSeeker, size int64,
+	alg ChecksumAlgorithm) (sum string, err error) {
+
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+	r, err := newChecksumReader(limitReader(seeker, size), alg)
+	if err != nil {
+		return
+	}
+	if _, err = io.Copy(io.Discard, r); err != nil {
+		return
+	}
+	n, err := seeker.Seek(pos, io.SeekStart)
+	if err == nil && n != pos {
+		err = fmt.Errorf("seek to %d returned %d", pos, n)
+	}
+	if err != nil {
+		return
+	}
+	return r.checksum(), nil
+}
+
+// limitReader returns reader which reads first size bytes of reader, or
+// reader itself if size is negative.
+func limitReader(reader io.Reader, size int64) io.Reader {
+	if size < 0 {
+		return reader
+	}
+	return io.LimitReader(reader, size)
+}
+
+// setChecksum sets object checksum sum in object user metadata after object
+// with etag was uploaded. This is the second write of object: its metadata is
+// replaced by server side copy of object onto itself, which fails if object
+// was changed after upload. The object stays without checksum and
+// ErrChecksumNotStored is returned if this copy fails. The upload of object
+// larger than maxCopyObjectSize is refused by uploadReader as it can not be
+// copied by single request.
+func (m *TeoS3) setChecksum(ctx context.Context, key, etag,
+	sum string) (err error) {
+
+	err = m.CopyTo(m, key, key, &CopyOptions{
+		Context:      ctx,
+		Overwrite:    OverwriteAlways,
+		Metadata:     MetadataMerge,
+		UserMetadata: map[string]string{ChecksumMetaKey: sum},
+		MatchETag:    etag,
+	})
+	if err != nil {
+		err = fmt.Errorf("%s: %w: %w", key, ErrChecksumNotStored, err)
+	}
+	return
+}
@@ -0,0 +1,243 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/teonet-go/teos3"
+)
+
+// streamReader hides Seek method of reader.
+type streamReader struct{ io.Reader }
+
+// changedSeeker is seeker which data is changed when it seeks to start.
+type changedSeeker struct {
+	*bytes.Reader
+	changed []byte
+}
+
+func (r *changedSeeker) Seek(offset int64, whence int) (int64, error) {
+	if whence == io.SeekStart {
+		r.Reader = bytes.NewReader(r.changed)
+	}
+	return r.Reader.Seek(offset, whence)
+}
+
+// sha256Checksum returns SHA256 checksum of data in metadata format.
+func sha256Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "SHA256:" + hex.EncodeToString(sum[:])
+}
+
+func TestSetObjectChecksum(t *testing.T) {
+	const key = "checksum/object"
+	old, data := []byte("old data"), []byte("checksum test data")
+
+	tests := []struct {
+		name   string
+		reader func() io.Reader
+		size   int64
+		want   []byte
+		err    error
+	}{
+		{"seeker", func() io.Reader { return bytes.NewReader(data) },
+			int64(len(data)), data, nil},
+		{"partial seeker", func() io.Reader { return bytes.NewReader(data) },
+			8, data[:8], nil},
+		{"stream", func() io.Reader {
+			return streamReader{bytes.NewReader(data)}
+		}, int64(len(data)), data, nil},
+		{"stream of unknown size", func() io.Reader {
+			return streamReader{bytes.NewReader(data)}
+		}, -1, data, nil},
+		{"changed seeker", func() io.Reader {
+			return &changedSeeker{bytes.NewReader(data), []byte("changed data!")}
+		}, int64(len(data)), old, teos3.ErrChecksumMismatch},
+	}
+
+	for backend, con := range connections(t, nil) {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				if err := con.Set(key, old); err != nil {
+					t.Fatal(err)
+				}
+
+				err := con.SetObject(key, tt.reader(), tt.size,
+					&teos3.SetOptions{StoreChecksum: teos3.ChecksumSHA256})
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+
+				// The failed upload keeps previous object
+				if got := get(t, con, key); !bytes.Equal(got, tt.want) {
+					t.Fatalf("got data %q, want %q", got, tt.want)
+				}
+				if tt.err != nil {
+					return
+				}
+				info, err := con.GetInfo(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := info.UserMetadata[teos3.ChecksumMetaKey]
+				if want := sha256Checksum(tt.want); got != want {
+					t.Fatalf("got checksum %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+// failingCopy is backend which fails server side copy of objects.
+type failingCopy struct{ teos3.Backend }
+
+func (b failingCopy) CopyObject(ctx context.Context, dst minio.CopyDestOptions,
+	src minio.CopySrcOptions) (minio.UploadInfo, error) {
+
+	return minio.UploadInfo{}, minio.ErrorResponse{
+		StatusCode: http.StatusForbidden,
+		Code:       "AccessDenied",
+		Message:    "Access Denied.",
+	}
+}
+
+// The checksum of not seekable reader is not stored if second write fails
+func TestSetObjectChecksumNotStored(t *testing.T) {
+	const key = "checksum/object"
+	data := []byte("checksum test data")
+
+	tests := []struct {
+		name   string
+		reader func() io.Reader
+		err    error
+	}{
+		{"seeker", func() io.Reader { return bytes.NewReader(data) }, nil},
+		{"stream", func() io.Reader {
+			return streamReader{bytes.NewReader(data)}
+		}, teos3.ErrChecksumNotStored},
+	}
+
+	wrap := func(name string, b teos3.Backend) teos3.Backend {
+		return failingCopy{b}
+	}
+	for _, tt := range tests {
+		for backend, con := range connections(t, wrap) {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				err := con.SetObject(key, tt.reader(), int64(len(data)),
+					&teos3.SetOptions{StoreChecksum: teos3.ChecksumSHA256})
+				switch {
+				case !errors.Is(err, tt.err):
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				case err != nil && !errors.Is(err, teos3.ErrAccessDenied):
+					t.Fatalf("got error %v, want %v", err,
+						teos3.ErrAccessDenied)
+				}
+
+				// The object is uploaded with or without checksum
+				if got := get(t, con, key); !bytes.Equal(got, data) {
+					t.Fatalf("got data %q, want %q", got, data)
+				}
+				info, err := con.GetInfo(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := sha256Checksum(data)
+				if tt.err != nil {
+					want = ""
+				}
+				got := info.UserMetadata[teos3.ChecksumMetaKey]
+				if got != want {
+					t.Fatalf("got checksum %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyWithChecksum(t *testing.T) {
+	data := []byte("checksum test data")
+
+	tests := []struct {
+		name     string
+		checksum string // Stored checksum, the uploaded checksum if empty
+		err      error
+	}{
+		{"verified", "", nil},
+		{"mismatch", sha256Checksum([]byte("other data")),
+			teos3.ErrChecksumMismatch},
+		// The metadata value of unknown algorithm is not verified
+		{"unknown algorithm", "other:value", nil},
+	}
+
+	for backend, con := range connections(t, nil) {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				src := filepath.Join(dir, "source")
+				dst := filepath.Join(dir, "target")
+				if err := os.WriteFile(src, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(dst, []byte("old"), 0644); err != nil {
+					t.Fatal(err)
+				}
+
+				// Upload file with checksum
+				opt := &teos3.CopyWithOptions{Checksum: teos3.ChecksumSHA256}
+				err := teos3.CopyWith(con, []string{src, "s3:file"}, opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				info, err := con.GetInfo("file")
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := info.UserMetadata[teos3.ChecksumMetaKey]
+				if want := sha256Checksum(data); got != want {
+					t.Fatalf("got checksum %q, want %q", got, want)
+				}
+
+				// Replace stored checksum
+				if tt.checksum != "" {
+					err = con.Set("file", data, &teos3.SetOptions{
+						SetObjectOptions: teos3.SetObjectOptions{
+							UserMetadata: map[string]string{
+								teos3.ChecksumMetaKey: tt.checksum,
+							},
+						},
+					})
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// Download and verify, the target is replaced only if
+				// checksum is verified
+				err = teos3.CopyWith(con, []string{"s3:file", dst})
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				want := data
+				if err != nil {
+					want = []byte("old")
+				}
+				if got, _ := os.ReadFile(dst); !bytes.Equal(got, want) {
+					t.Fatalf("got target %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
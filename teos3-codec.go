@@ -0,0 +1,105 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package typed map codecs module.
+
+package teos3
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec encodes and decodes typed Map values.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Typed Map codecs
+var (
+	// JSONCodec encodes values with encoding/json package.
+	JSONCodec Codec = jsonCodec{}
+
+	// GobCodec encodes values with encoding/gob package.
+	GobCodec Codec = gobCodec{}
+
+	// BytesCodec saves []byte or string values as is, including named
+	// types like 'type Blob []byte'.
+	BytesCodec Codec = bytesCodec{}
+)
+
+// jsonCodec is JSON Codec.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+// gobCodec is gob Codec.
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// bytesCodec is raw bytes Codec.
+type bytesCodec struct{}
+
+func (bytesCodec) Marshal(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+
+	// Named bytes slice and string types
+	switch rv := reflect.ValueOf(v); {
+	case rv.Kind() == reflect.String:
+		return []byte(rv.String()), nil
+	case rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8:
+		return rv.Bytes(), nil
+	}
+	return nil, fmt.Errorf("bytes codec: unsupported value type %T", v)
+}
+
+func (bytesCodec) Unmarshal(data []byte, v any) error {
+	switch v := v.(type) {
+	case *[]byte:
+		*v = data
+	case *string:
+		*v = string(data)
+	default:
+		// Named bytes slice and string types
+		if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer &&
+			!rv.IsNil() {
+
+			switch rv = rv.Elem(); {
+			case rv.Kind() == reflect.String:
+				rv.SetString(string(data))
+				return nil
+			case rv.Kind() == reflect.Slice &&
+				rv.Type().Elem().Kind() == reflect.Uint8:
+				rv.SetBytes(data)
+				return nil
+			}
+		}
+		return fmt.Errorf("bytes codec: unsupported value type %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/teonet-go/teos3"
+)
+
+// Codecs test value types
+type (
+	user struct {
+		Name string
+		Age  int
+	}
+	blob []byte
+	text string
+)
+
+func TestCodecs(t *testing.T) {
+	tests := []struct {
+		name  string
+		codec teos3.Codec
+		value any
+		err   bool
+	}{
+		{"json", teos3.JSONCodec, user{"Kirill", 30}, false},
+		{"json map", teos3.JSONCodec, map[string]int{"a": 1}, false},
+		{"gob", teos3.GobCodec, user{"Kirill", 30}, false},
+		{"gob slice", teos3.GobCodec, []string{"a", "b"}, false},
+		{"bytes", teos3.BytesCodec, []byte("data"), false},
+		{"bytes string", teos3.BytesCodec, "data", false},
+		{"bytes named slice", teos3.BytesCodec, blob("data"), false},
+		{"bytes named string", teos3.BytesCodec, text("data"), false},
+		{"bytes unsupported", teos3.BytesCodec, 10, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := tt.codec.Marshal(tt.value)
+			if tt.err {
+				if err == nil {
+					t.Fatal("marshal error is not returned")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			value := reflect.New(reflect.TypeOf(tt.value))
+			if err := tt.codec.Unmarshal(data, value.Interface()); err != nil {
+				t.Fatal(err)
+			}
+			if got := value.Elem().Interface(); !reflect.DeepEqual(got,
+				tt.value) {
+				t.Fatalf("got %#v, want %#v", got, tt.value)
+			}
+		})
+	}
+
+	// Unsupported value type is not decoded by bytes codec
+	var i int
+	if err := teos3.BytesCodec.Unmarshal([]byte("10"), &i); err == nil {
+		t.Fatal("unmarshal error is not returned")
+	}
+}
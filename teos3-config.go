@@ -0,0 +1,348 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package config file module.
+
+package teos3
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// DefaultProfile is the config profile name used if profile name is not set
+// in arguments, TEOS3_PROFILE environment variable and config file.
+const DefaultProfile = "default"
+
+// ErrEndpointNotSet is returned by Flags.Connect if S3 storage endpoint is
+// not set in flags and config profile.
+var ErrEndpointNotSet = errors.New("endpoint is not set")
+
+// Config is the teos3 tools config file. The config file is YAML file with
+// named profiles:
+//
+//	default: staging
+//	profiles:
+//	  staging:
+//	    endpoint: s3.staging.example.com
+//	    bucket: teos3
+//	    secure: true
+//	    region: us-east-1
+//	    bucket_lookup: path
+//	    credentials:
+//	      aws_profile: staging
+//	  production:
+//	    endpoint: gateway.storjshare.io
+//	    bucket: teos3
+//	    credentials:
+//	      token_file: ~/.config/teos3/production-token.json
+type Config struct {
+
+	// Default is the profile name used if profile name is not set.
+	Default string `yaml:"default"`
+
+	// Profiles contains profiles by name.
+	Profiles map[string]*Profile `yaml:"profiles"`
+
+	filename string
+}
+
+// Profile is the config file profile which contains S3 storage connection
+// parameters.
+type Profile struct {
+	Endpoint     string             `yaml:"endpoint"`
+	Bucket       string             `yaml:"bucket"`
+	Secure       *bool              `yaml:"secure"`
+	Region       string             `yaml:"region"`
+	BucketLookup string             `yaml:"bucket_lookup"`
+	CABundle     string             `yaml:"ca_bundle"`
+	CreateBucket bool               `yaml:"create_bucket"`
+	Credentials  ProfileCredentials `yaml:"credentials"`
+}
+
+// ProfileCredentials is the profile credentials source. The explicit keys,
+// AWS shared files profile and session token file are used in credentials
+// chain created by NewCredentials.
+type ProfileCredentials struct {
+	AccessKey    string `yaml:"access_key"`
+	SecretKey    string `yaml:"secret_key"`
+	SessionToken string `yaml:"session_token"`
+	AWSProfile   string `yaml:"aws_profile"`
+	TokenFile    string `yaml:"token_file"`
+}
+
+// ConfigFile returns teos3 config file name: the TEOS3_CONFIG environment
+// variable or ~/.config/teos3/config.yaml on all platforms. The
+// XDG_CONFIG_HOME environment variable is used instead of ~/.config if set.
+func ConfigFile() (filename string, err error) {
+	if filename = os.Getenv("TEOS3_CONFIG"); filename != "" {
+		return
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		var home string
+		if home, err = os.UserHomeDir(); err != nil {
+			return
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	filename = filepath.Join(dir, "teos3", "config.yaml")
+	return
+}
+
+// LoadConfig loads config file by name. The ConfigFile is used if filename
+// is empty.
+func LoadConfig(filename string) (config *Config, err error) {
+
+	if filename == "" {
+		if filename, err = ConfigFile(); err != nil {
+			return
+		}
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	config = &Config{filename: filename}
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err = decoder.Decode(config); err != nil {
+		config, err = nil, fmt.Errorf("config file %s: %w", filename, err)
+	}
+	return
+}
+
+// Profile returns config profile by name. If name is empty the
+// TEOS3_PROFILE environment variable, config Default or DefaultProfile name
+// is used.
+func (c *Config) Profile(name string) (profile *Profile, err error) {
+	if name == "" {
+		name = os.Getenv("TEOS3_PROFILE")
+	}
+	if name == "" {
+		name = c.Default
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+
+	profile, ok := c.Profiles[name]
+	if !ok || profile == nil {
+		err = fmt.Errorf("profile %s not found in config file %s", name,
+			c.filename)
+	}
+	return
+}
+
+// Options returns New options created from profile parameters.
+func (p *Profile) Options() (options []Option, err error) {
+
+	lookup, err := parseBucketLookup(p.BucketLookup)
+	if err != nil {
+		return
+	}
+
+	options = []Option{
+		WithCredentials(p.Credentials.AccessKey, p.Credentials.SecretKey,
+			p.Credentials.SessionToken),
+		WithProfile(p.Credentials.AWSProfile),
+		WithTokenFile(expandHome(p.Credentials.TokenFile)),
+		WithDefaultBucket(p.Bucket),
+		WithRegion(p.Region),
+		WithBucketLookup(lookup),
+	}
+	if p.Secure != nil {
+		options = append(options, WithSecure(*p.Secure))
+	}
+	if p.CABundle != "" {
+		options = append(options, WithCABundle(expandHome(p.CABundle)))
+	}
+	if p.CreateBucket {
+		options = append(options, WithCreateBucket())
+	}
+	return
+}
+
+// Connect creates new connection to S3 storage using profile parameters.
+// The options arguments are applied after profile options, so they may
+// change profile parameters.
+func (p *Profile) Connect(options ...Option) (teos3 *TeoS3, err error) {
+	if p.Endpoint == "" {
+		err = ErrEndpointNotSet
+		return
+	}
+	opts, err := p.Options()
+	if err != nil {
+		return
+	}
+	return New(p.Endpoint, append(opts, options...)...)
+}
+
+// ConnectProfile creates new connection to S3 storage using profile from
+// the default config file. If name is empty the TEOS3_PROFILE environment
+// variable, config Default or DefaultProfile name is used. The options
+// arguments are applied after profile options.
+//
+//	con, err := teos3.ConnectProfile("staging")
+func ConnectProfile(name string, options ...Option) (teos3 *TeoS3,
+	err error) {
+
+	config, err := LoadConfig("")
+	if err != nil {
+		return
+	}
+	profile, err := config.Profile(name)
+	if err != nil {
+		return
+	}
+	return profile.Connect(options...)
+}
+
+// Flags contains teos3 tools connection flags: -profile, -accesskey,
+// -secretkey, -endpoint, -bucket and -secure. The flags default values are
+// taken from TEOS3_* environment variables. The connection parameters are
+// taken from environment variables, than from config file profile and than
+// from flags set in command line, each next source overrides previous one.
+type Flags struct {
+	Profile   string
+	AccessKey string
+	SecretKey string
+	Endpoint  string
+	Bucket    string
+	Secure    bool
+
+	flags *flag.FlagSet
+}
+
+// NewFlags defines teos3 tools connection flags in flag set. The
+// flag.CommandLine is used if flags is nil.
+func NewFlags(flags *flag.FlagSet) (f *Flags) {
+	if flags == nil {
+		flags = flag.CommandLine
+	}
+
+	f = &Flags{
+		Profile:   os.Getenv("TEOS3_PROFILE"),
+		AccessKey: os.Getenv("TEOS3_ACCESSKEY"),
+		SecretKey: os.Getenv("TEOS3_SECRETKEY"),
+		Endpoint:  os.Getenv("TEOS3_ENDPOINT"),
+		Bucket:    os.Getenv("TEOS3_BUCKET"),
+		Secure:    true,
+		flags:     flags,
+	}
+
+	flags.StringVar(&f.Profile, "profile", f.Profile, "config file profile")
+	flags.StringVar(&f.AccessKey, "accesskey", f.AccessKey,
+		"S3 storage Access key")
+	flags.StringVar(&f.SecretKey, "secretkey", f.SecretKey,
+		"S3 storage Secret key")
+	flags.StringVar(&f.Endpoint, "endpoint", f.Endpoint, "S3 storage Endpoint")
+	flags.StringVar(&f.Bucket, "bucket", f.Bucket, "S3 storage Bucket")
+	flags.BoolVar(&f.Secure, "secure", f.Secure,
+		"set secure=false to enable insecure (HTTP) access")
+
+	return
+}
+
+// Connect creates new connection to S3 storage using parsed flags. The config
+// file profile is used if -profile flag is set or if -endpoint flag is not
+// set in command line and config file exists. The profile parameters
+// override TEOS3_* environment variables and flags set in command line
+// override profile parameters. The options arguments are applied last.
+func (f *Flags) Connect(options ...Option) (teos3 *TeoS3, err error) {
+
+	// Get flags set in command line, the other flags contain environment
+	// variables values
+	set := make(map[string]bool)
+	f.flags.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	// Connect without profile
+	connect := func() (*TeoS3, error) {
+		return New(f.Endpoint, append([]Option{
+			WithCredentials(f.AccessKey, f.SecretKey),
+			WithSecure(f.Secure),
+			WithDefaultBucket(f.Bucket),
+		}, options...)...)
+	}
+	if f.Profile == "" && set["endpoint"] {
+		return connect()
+	}
+
+	// Load config profile, the TEOS3_ENDPOINT environment variable is used
+	// if config file does not exist
+	config, err := LoadConfig("")
+	if err != nil {
+		if f.Profile == "" && errors.Is(err, os.ErrNotExist) {
+			if f.Endpoint != "" {
+				return connect()
+			}
+			err = ErrEndpointNotSet
+		}
+		return
+	}
+	profile, err := config.Profile(f.Profile)
+	if err != nil {
+		return
+	}
+
+	// Override environment variables with profile parameters and profile
+	// parameters with flags set in command line
+	p := *profile
+	if set["endpoint"] || p.Endpoint == "" {
+		p.Endpoint = f.Endpoint
+	}
+	if set["bucket"] || p.Bucket == "" {
+		p.Bucket = f.Bucket
+	}
+	if set["secure"] {
+		p.Secure = &f.Secure
+	}
+	if set["accesskey"] || set["secretkey"] ||
+		p.Credentials == (ProfileCredentials{}) {
+		p.Credentials = ProfileCredentials{
+			AccessKey: f.AccessKey,
+			SecretKey: f.SecretKey,
+		}
+	}
+
+	return p.Connect(options...)
+}
+
+// parseBucketLookup returns BucketLookupType by name: auto, path or
+// virtual-host.
+func parseBucketLookup(name string) (lookup BucketLookupType, err error) {
+	switch strings.ToLower(name) {
+	case "", "auto":
+		lookup = BucketLookupAuto
+	case "path":
+		lookup = BucketLookupPath
+	case "virtual-host", "dns":
+		lookup = BucketLookupVirtualHost
+	default:
+		err = fmt.Errorf("wrong bucket lookup type %s", name)
+	}
+	return
+}
+
+// expandHome replaces leading ~/ in file name with user home directory.
+func expandHome(name string) string {
+	rest, ok := strings.CutPrefix(name, "~/")
+	if !ok {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return name
+	}
+	return filepath.Join(home, rest)
+}
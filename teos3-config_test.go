@@ -0,0 +1,79 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/teonet-go/teos3"
+	"github.com/teonet-go/teos3/teos3test"
+)
+
+func TestFlagsConnect(t *testing.T) {
+	envSrv, profileSrv := teos3test.NewServer(), teos3test.NewServer()
+	defer envSrv.Close()
+	defer profileSrv.Close()
+
+	tests := []struct {
+		name   string
+		config bool     // config file exists
+		args   []string // command line arguments
+		want   *teos3test.Server
+	}{
+		{"environment", false, nil, envSrv},
+		{"profile overrides environment", true, nil, profileSrv},
+		{"flag overrides profile", true,
+			[]string{"-endpoint", envSrv.Endpoint()}, envSrv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := filepath.Join(dir, "config.yaml")
+			t.Setenv("TEOS3_CONFIG", config)
+			t.Setenv("TEOS3_PROFILE", "")
+			t.Setenv("TEOS3_ENDPOINT", envSrv.Endpoint())
+			t.Setenv("TEOS3_ACCESSKEY", teos3test.AccessKey)
+			t.Setenv("TEOS3_SECRETKEY", teos3test.SecretKey)
+			t.Setenv("TEOS3_BUCKET", "")
+			if tt.config {
+				data := fmt.Sprintf("profiles:\n  default:\n"+
+					"    endpoint: %s\n    secure: false\n",
+					profileSrv.Endpoint())
+				err := os.WriteFile(config, []byte(data), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			f := teos3.NewFlags(flags)
+			err := flags.Parse(append([]string{"-secure=false"}, tt.args...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			con, err := f.Connect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = con.Set(tt.name, []byte("data")); err != nil {
+				t.Fatal(err)
+			}
+
+			// The object is saved by wanted server
+			want, err := tt.want.Connect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = want.GetInfo(tt.name); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
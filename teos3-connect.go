@@ -0,0 +1,281 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package connect options module.
+
+package teos3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Option sets New connection option.
+type Option func(o *connectOptions) error
+
+// connectOptions contains New connection options.
+type connectOptions struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	profile      string
+	tokenFile    string
+	creds        *credentials.Credentials
+	secure       bool
+	bucket       string
+	region       string
+	transport    http.RoundTripper
+	caBundle     string
+	context      context.Context
+	bucketLookup BucketLookupType
+	createBucket bool
+}
+
+// BucketLookupType is bucket lookup style used to address buckets in
+// requests to S3 storage.
+type BucketLookupType minio.BucketLookupType
+
+// Bucket lookup styles
+const (
+	// BucketLookupAuto detects bucket lookup style by endpoint.
+	BucketLookupAuto = BucketLookupType(minio.BucketLookupAuto)
+
+	// BucketLookupPath addresses bucket in request path:
+	// https://endpoint/bucket/key.
+	BucketLookupPath = BucketLookupType(minio.BucketLookupPath)
+
+	// BucketLookupVirtualHost addresses bucket in request host name:
+	// https://bucket.endpoint/key.
+	BucketLookupVirtualHost = BucketLookupType(minio.BucketLookupDNS)
+)
+
+// WithCredentials sets S3 storage access and secret keys. The optional
+// session token is used with temporary credentials. The credentials chain
+// created by NewCredentials is used to get credentials if keys are empty.
+func WithCredentials(accessKey, secretKey string, sessionToken ...string) Option {
+	return func(o *connectOptions) error {
+		o.accessKey, o.secretKey = accessKey, secretKey
+		if len(sessionToken) > 0 {
+			o.sessionToken = sessionToken[0]
+		}
+		return nil
+	}
+}
+
+// WithProfile sets AWS shared credentials and config files profile used in
+// credentials chain.
+func WithProfile(profile string) Option {
+	return func(o *connectOptions) error {
+		o.profile = profile
+		return nil
+	}
+}
+
+// WithTokenFile sets session token file used in credentials chain. The file
+// is re-read when the token expires or the file changes, so the keys may be
+// rotated without restarting the application.
+func WithTokenFile(tokenFile string) Option {
+	return func(o *connectOptions) error {
+		o.tokenFile = tokenFile
+		return nil
+	}
+}
+
+// WithCredentialsProvider sets custom credentials which are used instead of
+// the credentials chain.
+func WithCredentialsProvider(creds *credentials.Credentials) Option {
+	return func(o *connectOptions) error {
+		o.creds = creds
+		return nil
+	}
+}
+
+// WithSecure sets HTTPS connection if true or HTTP if false. The HTTPS is
+// used by default.
+func WithSecure(secure bool) Option {
+	return func(o *connectOptions) error {
+		o.secure = secure
+		return nil
+	}
+}
+
+// WithDefaultBucket sets default bucket name of connection. The default
+// 'teos3' bucket name is used if bucket does not set or empty. Use
+// TeoS3.WithBucket to get view of another bucket of the connection.
+func WithDefaultBucket(bucket string) Option {
+	return func(o *connectOptions) error {
+		o.bucket = bucket
+		return nil
+	}
+}
+
+// WithRegion sets S3 storage region.
+func WithRegion(region string) Option {
+	return func(o *connectOptions) error {
+		o.region = region
+		return nil
+	}
+}
+
+// WithTransport sets custom HTTP transport used to send requests to S3
+// storage.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(o *connectOptions) error {
+		o.transport = transport
+		return nil
+	}
+}
+
+// WithCABundle sets PEM encoded CA certificates file which is used to verify
+// S3 storage server certificate in addition to system certificates. The
+// custom transport set by WithTransport must be *http.Transport if CA bundle
+// is used.
+func WithCABundle(caFile string) Option {
+	return func(o *connectOptions) error {
+		o.caBundle = caFile
+		return nil
+	}
+}
+
+// WithContext sets default context which will be used in all TeoS3
+// operations if another context does not send in function call options
+// argument. The context may be changed later with SetContext.
+func WithContext(ctx context.Context) Option {
+	return func(o *connectOptions) error {
+		if ctx == nil {
+			return errors.New("nil context")
+		}
+		o.context = ctx
+		return nil
+	}
+}
+
+// WithBucketLookup sets bucket lookup style. The BucketLookupAuto is used by
+// default.
+func WithBucketLookup(lookup BucketLookupType) Option {
+	return func(o *connectOptions) error {
+		o.bucketLookup = lookup
+		return nil
+	}
+}
+
+// WithCreateBucket sets New to create the bucket if it does not exist. The
+// bucket is created in the region set by WithRegion.
+func WithCreateBucket() Option {
+	return func(o *connectOptions) error {
+		o.createBucket = true
+		return nil
+	}
+}
+
+// New creates new connection to S3 storage by endpoint and options. The
+// endpoint argument must be specified without http/https prefix (just domain
+// and path).
+//
+//	con, err := teos3.New("gateway.storjshare.io",
+//		teos3.WithCredentials(accessKey, secretKey),
+//		teos3.WithDefaultBucket("my-bucket"),
+//	)
+func New(endpoint string, options ...Option) (teos3 *TeoS3, err error) {
+
+	// Apply options
+	opt := &connectOptions{secure: true, context: context.Background()}
+	for _, option := range options {
+		if err = option(opt); err != nil {
+			return
+		}
+	}
+
+	// Create transport with CA bundle
+	transport := opt.transport
+	if opt.caBundle != "" {
+		if transport, err = opt.caTransport(); err != nil {
+			return
+		}
+	}
+
+	// Create credentials chain
+	creds := opt.creds
+	if creds == nil {
+		creds = NewCredentials(CredentialsOptions{
+			AccessKey:    opt.accessKey,
+			SecretKey:    opt.secretKey,
+			SessionToken: opt.sessionToken,
+			Profile:      opt.profile,
+			TokenFile:    opt.tokenFile,
+		})
+	}
+
+	// Connect to S3 storage
+	con, err := minio.New(endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       opt.secure,
+		Region:       opt.region,
+		Transport:    transport,
+		BucketLookup: minio.BucketLookupType(opt.bucketLookup),
+	})
+	if err != nil {
+		return
+	}
+
+	teos3 = ConnectBackend(NewMinioBackend(con), opt.bucket)
+	teos3.SetContext(opt.context)
+
+	// Create bucket
+	if opt.createBucket {
+		err = teos3.EnsureBucket(&BucketOptions{
+			MakeBucketOptions: MakeBucketOptions{Region: opt.region},
+		})
+		if err != nil {
+			teos3 = nil
+		}
+	}
+	return
+}
+
+// caTransport returns HTTP transport which trusts CA bundle certificates.
+func (o *connectOptions) caTransport() (transport *http.Transport, err error) {
+
+	// Read CA bundle
+	pem, err := os.ReadFile(o.caBundle)
+	if err != nil {
+		return
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("no certificates found in CA bundle %s", o.caBundle)
+		return
+	}
+
+	// Clone custom or default transport
+	switch t := o.transport.(type) {
+	case nil:
+		transport, err = minio.DefaultTransport(true)
+		if err != nil {
+			return
+		}
+	case *http.Transport:
+		transport = t.Clone()
+	default:
+		err = fmt.Errorf("CA bundle can not be used with %T transport", t)
+		return
+	}
+
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	transport.TLSClientConfig.RootCAs = pool
+	return
+}
@@ -8,14 +8,25 @@ package teos3
 
 import (
 	"bufio"
+	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
+	"path"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
 )
 
 // Copy copys s3 object from source to target. Source or Target may be s3
-// storage object. Use 's3:' prefix to define s3 object.
+// storage object. Use 's3:' prefix to define s3 object. Use CopyWith to copy
+// with progress reporting, cancellation or recursive copy.
 func Copy(accessKey, secretKey, endpoint, bucket string, args []string,
 	secures ...bool) (err error) {
 
@@ -26,110 +37,691 @@ func Copy(accessKey, secretKey, endpoint, bucket string, args []string,
 	}
 
 	// Connect to teonet S3 storage
-	var connected bool
-	var teoS3conn *TeoS3
-	connectS3 := func() (con *TeoS3) {
-		if connected {
-			con = teoS3conn
-			return con
-		}
-		con, err = Connect(accessKey, secretKey, endpoint, secure, bucket)
-		if err != nil {
-			log.Fatalln(err)
-		}
-		log.Println("connect to s3 storage")
-		connected = true
-		teoS3conn = con
+	con, err := Connect(accessKey, secretKey, endpoint, secure, bucket)
+	if err != nil {
+		log.Println("error", err)
 		return
 	}
 
-	var sourceLen int64
-	var sourceObj io.Reader
-	for i := range args {
+	return CopyWith(con, args)
+}
 
-		// Trim and check S3 prefix in arguments
-		args[i] = strings.Trim(args[i], " \t")
-		s3 := strings.Index(args[i], "s3:") == 0
-		var key string
-		if s3 {
-			key = args[i][3:]
-		} else {
-			key = args[i]
-		}
+// CopyWith copys sources to target using connection con. The last argument
+// is the target, all other arguments are sources. Source or Target may be s3
+// storage object. Use 's3:key' to define s3 object in con bucket and
+// 's3://bucket/key' to define s3 object in another bucket of con connection.
+// Use '-' to copy from standard input or to standard output (opt.Stdin and
+// opt.Stdout), the standard input of unknown length is uploaded to s3 by
+// multipart streaming. The options parameter may be omitted and than default
+// CopyWithOptions with connection context used. If the options context is
+// canceled, the copy is stopped, incomplete multipart upload of target s3
+// object is aborted and incomplete target file is removed.
+//
+// If there are several sources, or the target is existing directory or s3
+// folder (key ending with '/'), the sources are copied into target under
+// their base names. The s3 objects are copied to s3 targets on server side by
+// TeoS3.CopyTo, existing target objects are replaced.
+//
+// If opt.Recursive is set and source is local directory or s3 folder, all
+// files of source are copied to target directory or folder in opt.Workers
+// concurrent copies. The files relative paths are preserved and the
+// directories are created as target folders. The errors of sources and
+// files are joined and returned after all sources processed.
+//
+//	err := teos3.CopyWith(con, []string{"a.txt", "b.txt", "s3:docs/"})
+//	err = teos3.CopyWith(con, []string{"s3:docs/a.txt", "s3://archive/docs/"})
+//	err = teos3.CopyWith(con, []string{"-", "s3:backups/db.sql.gz"})
+func CopyWith(con *TeoS3, args []string, options ...*CopyWithOptions) (
+	err error) {
+
+	// Set options
+	opt := con.getCopyWithOptions(options...)
 
-		// Log error, get and set functions
-		logError := func(err error) {
+	// Check arguments
+	if len(args) < 2 {
+		err = fmt.Errorf("wrong number of arguments %d, should be source "+
+			"and target", len(args))
+		log.Println("error", err)
+		return
+	}
+	sources := args[:len(args)-1]
+	target := parseCopyArg(con, args[len(args)-1])
+	if len(sources) > 1 && !target.isDir() {
+		err = fmt.Errorf("target %s is not a directory", target.name)
+		log.Println("error", err)
+		return
+	}
+
+	// Copy sources
+	sum := new(summary)
+	var errs []error
+	for _, arg := range sources {
+		if err = opt.Context.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		src := parseCopyArg(con, arg)
+		folder := opt.Recursive && src.isFolder(opt.Context)
+		if src.std && target.isDir() || folder && target.std {
+			err = fmt.Errorf("can not copy %s to %s", src.name, target.name)
 			log.Println("error", err)
+			errs = append(errs, err)
+			continue
 		}
-		logSet := func(key string) {
-			log.Println("got data from", key)
+		dst := target
+		if len(sources) > 1 || !folder && target.isDir() {
+			dst = target.join(src.base())
 		}
-		logGet := func(key string) {
-			log.Println("set data to", key)
+		if err = copySource(src, dst, folder, opt, sum); err != nil {
+			errs = append(errs, err)
 		}
+	}
 
-		// Argument type
-		const (
-			Source = iota
-			Target
-		)
+	return sum.result(opt.Summary, errors.Join(errs...))
+}
 
-		// Switch by argument type
-		switch i {
+// streamPartSize is the part size of multipart upload of unknown length
+// source. The 10000 parts of this size contain maximum 640 GiB object.
+const streamPartSize = 64 << 20
 
-		case Source:
+// copyArg is CopyWith source or target argument.
+type copyArg struct {
+	name string // Argument
+	s3   bool   // Argument is s3 object
+	std  bool   // Argument is standard input or output
+	con  *TeoS3 // TeoS3 view of s3 object bucket
+	key  string // S3 object key or file path
+}
 
-			// Get S3 object
-			if s3 {
-				obj, err := connectS3().GetObject(key)
-				if err != nil {
-					logError(err)
-					return err
-				}
-				defer obj.Close()
-				sourceObj = obj
-				objStat, _ := obj.Stat()
-				sourceLen = objStat.Size
-				logSet(args[i])
-				continue
-			}
+// parseCopyArg parses CopyWith argument. The 's3://bucket/key' argument
+// gets view of the bucket of con connection.
+func parseCopyArg(con *TeoS3, arg string) (a copyArg) {
+	a.name = strings.Trim(arg, " \t")
+	a.std = a.name == "-"
+	a.key, a.s3 = strings.CutPrefix(a.name, "s3:")
+	if !a.s3 {
+		return
+	}
+	a.con = con
+	if bucketKey, ok := strings.CutPrefix(a.key, "//"); ok {
+		var bucket string
+		bucket, a.key, _ = strings.Cut(bucketKey, "/")
+		a.con = con.WithBucket(bucket)
+	}
+	return
+}
 
-			// Get file
-			file, err := os.Open(key)
+// isFolder returns true if argument is local directory or s3 folder: bucket
+// root, key ending with '/' or key which has objects inside it.
+func (a copyArg) isFolder(ctx context.Context) bool {
+	if !a.s3 || a.isDir() {
+		return a.isDir()
+	}
+	for _, err := range a.con.Keys(a.key+"/", &ListOptions{Context: ctx}) {
+		return err == nil
+	}
+	return false
+}
+
+// isDir returns true if argument is s3 folder (key ending with '/' or bucket
+// root) or existing local directory.
+func (a copyArg) isDir() bool {
+	switch {
+	case a.std:
+		return false
+	case a.s3:
+		return a.key == "" || isFolder(a.key)
+	}
+	info, err := os.Stat(a.key)
+	return err == nil && info.IsDir()
+}
+
+// base returns last element of argument path. The bucket name is returned
+// for s3 bucket root.
+func (a copyArg) base() string {
+	if !a.s3 {
+		return filepath.Base(a.key)
+	}
+	if key := strings.Trim(a.key, "/"); key != "" {
+		return path.Base(key)
+	}
+	return a.con.Bucket()
+}
+
+// join returns argument of file or object with slash separated name inside
+// folder argument.
+func (a copyArg) join(name string) copyArg {
+	if a.s3 {
+		a.key = folderKey(a.key) + name
+		a.name = "s3://" + a.con.Bucket() + "/" + a.key
+	} else {
+		a.key = filepath.Join(a.key, filepath.FromSlash(name))
+		a.name = a.key
+	}
+	return a
+}
+
+// folderKey returns key ending with '/'. The empty key is not changed.
+func folderKey(key string) string {
+	if key == "" || isFolder(key) {
+		return key
+	}
+	return key + "/"
+}
+
+// copySource copys source to target and adds it to summary. The folder
+// source is copied recursively.
+func copySource(src, dst copyArg, folder bool, opt *CopyWithOptions,
+	sum *summary) (err error) {
+
+	switch {
+	case src.s3 && dst.s3:
+		return copyObjects(src, dst, folder, opt, sum)
+	case folder:
+		return copyFolder(src, dst, opt, sum)
+	case src.s3 && isFolder(src.key):
+		err = fmt.Errorf("%s is a folder, use recursive copy", src.name)
+		log.Println("error", err)
+		return
+	}
+
+	info, err := copyFile(src, dst, opt, nil, nil)
+	if err == nil {
+		sum.done(minio.ObjectInfo{Key: dst.key, Size: info.Size})
+	}
+	return
+}
+
+// copyObjects copys s3 source object or folder to s3 target on server side
+// and adds copied objects to summary.
+func copyObjects(src, dst copyArg, folder bool, opt *CopyWithOptions,
+	sum *summary) (err error) {
+
+	source, destination := src.key, dst.key
+	if folder {
+		source, destination = folderKey(source), folderKey(destination)
+	}
+	switch {
+	case folder && source == "":
+		err = fmt.Errorf("%s is a bucket root, copy of whole bucket is not "+
+			"supported", src.name)
+	case !folder && isFolder(source):
+		err = fmt.Errorf("%s is a folder, use recursive copy", src.name)
+	}
+	if err != nil {
+		log.Println("error", err)
+		return
+	}
+
+	// Copy on server side, the progress is reported after copy
+	p := newProgress(src.name, -1, opt.Progress, opt.ProgressInterval)
+	var s Summary
+	err = src.con.CopyTo(dst.con, source, destination, &CopyOptions{
+		Context:   opt.Context,
+		Overwrite: OverwriteAlways,
+		Workers:   opt.Workers,
+		Summary:   &s,
+	})
+	sum.add(s)
+	if err != nil {
+		log.Println("error", err)
+		if len(s.Failed) > 0 {
+			// Objects errors are returned in summary
+			err = nil
+		}
+		return
+	}
+	p.add(s.Bytes)
+	p.finish()
+	log.Println("copied", src.name, "to", dst.name)
+
+	return
+}
+
+// copyFile copys source file or s3 object to target and returns source info
+// with target s3 object ETag. The size of copied data is returned in info
+// if source size is unknown. The p is shared progress of recursive copy,
+// progress of one file is created and finished if p is nil. The meta is user
+// metadata of target s3 object.
+//
+// The opt.Checksum of uploaded data is stored in target s3 object metadata,
+// the checksum stored in source s3 object metadata is verified while
+// downloading. The target file is written to temporary file which is synced
+// and renamed to target only after its size and checksum verified.
+func copyFile(src, dst copyArg, opt *CopyWithOptions, p *progress,
+	meta map[string]string) (info minio.ObjectInfo, err error) {
+
+	// Log error, get and set functions
+	logError := func(err error) {
+		log.Println("error", err)
+	}
+	logSet := func(key string) {
+		log.Println("got data from", key)
+	}
+	logGet := func(key string) {
+		log.Println("set data to", key)
+	}
+
+	// Open source
+	source, info, err := openSource(src, opt)
+	if err != nil {
+		logError(err)
+		return
+	}
+	defer source.Close()
+	logSet(src.name)
+
+	// Report progress of reading source
+	finish := p == nil
+	if finish {
+		p = newProgress(src.name, info.Size, opt.Progress,
+			opt.ProgressInterval)
+	}
+	// Count copied bytes of standard input which size is unknown
+	counter := &countReader{Reader: p.reader(source)}
+	var reader io.Reader = counter
+	defer func() {
+		if err == nil && info.Size < 0 {
+			info.Size = counter.n
+		}
+	}()
+
+	// Save source to S3
+	if dst.s3 {
+		setOpt := &SetOptions{Context: opt.Context}
+		setOpt.UserMetadata = meta
+		setOpt.StoreChecksum = opt.Checksum
+		if info.Size < 0 {
+			setOpt.PartSize = streamPartSize
+		}
+
+		// Calculate checksum of source file before upload, the checksum of
+		// s3 object and standard input is calculated while uploading
+		var sum string
+		if !src.s3 && !src.std && opt.Checksum != "" {
+			sum, err = fileChecksum(src.key, info.Size, opt.Checksum)
 			if err != nil {
 				logError(err)
-				return err
+				return
 			}
-			defer file.Close()
-			sourceObj = bufio.NewReader(file)
-			fileStat, _ := file.Stat()
-			sourceLen = fileStat.Size()
-			logSet(args[i])
+			sum = formatChecksum(opt.Checksum, sum)
+		}
+
+		var upload minio.UploadInfo
+		upload, err = dst.con.setObject(dst.key, reader, info.Size, setOpt,
+			sum)
+		if err != nil {
+			logError(err)
+			return
+		}
+		info.ETag = upload.ETag
+		if finish {
+			p.finish()
+		}
+		logGet(dst.name)
+		return
+	}
+
+	// Verify size and checksum of downloaded data
+	check, err := verifyReader(reader, info)
+	if err != nil {
+		logError(err)
+		return
+	}
+	if check != nil {
+		reader = check
+	}
+	verify := func(n int64) error {
+		if info.Size >= 0 && n != info.Size {
+			return fmt.Errorf("%s: copied %d of %d bytes: %w", src.name, n,
+				info.Size, io.ErrUnexpectedEOF)
+		}
+		return check.verify(src.name, objectChecksum(info))
+	}
+
+	// Write source to standard output, the data is already written when
+	// it is verified
+	if dst.std {
+		var n int64
+		if n, err = io.Copy(opt.Stdout, reader); err == nil {
+			err = verify(n)
+		}
+		if err != nil {
+			logError(err)
+			return
+		}
+		if finish {
+			p.finish()
+		}
+		logGet(dst.name)
+		return
+	}
+
+	// Save source to file
+	if err = saveFile(dst.key, reader, verify); err != nil {
+		logError(err)
+		return
+	}
+	if finish {
+		p.finish()
+	}
+	logGet(dst.name)
+
+	return
+}
 
-		case Target:
+// openSource opens source file, s3 object or standard input and returns its
+// reader and info. The standard input size is -1.
+func openSource(src copyArg, opt *CopyWithOptions) (reader io.ReadCloser,
+	info minio.ObjectInfo, err error) {
 
-			// Save source to S3
-			if s3 {
-				err = connectS3().SetObject(key, sourceObj, sourceLen)
+	// Get standard input
+	if src.std {
+		info.Size = -1
+		return io.NopCloser(&contextReader{opt.Context, opt.Stdin}), info, nil
+	}
+
+	// Get S3 object
+	if src.s3 {
+		obj, err := src.con.GetObject(src.key,
+			&GetOptions{Context: opt.Context})
+		if err != nil {
+			return nil, info, err
+		}
+		info, err = obj.Stat()
+		if err != nil {
+			obj.Close()
+			return nil, info, wrapError(err)
+		}
+		return obj, info, nil
+	}
+
+	// Get file
+	file, err := os.Open(src.key)
+	if err != nil {
+		return
+	}
+	fileInfo, err := file.Stat()
+	if err == nil && fileInfo.IsDir() {
+		err = fmt.Errorf("%s is a directory, use recursive copy", src.name)
+	}
+	if err != nil {
+		file.Close()
+		return
+	}
+	reader = struct {
+		io.Reader
+		io.Closer
+	}{&contextReader{opt.Context, bufio.NewReader(file)}, file}
+	info.Key = src.key
+	info.Size = fileInfo.Size()
+	info.LastModified = fileInfo.ModTime()
+	return reader, info, nil
+}
+
+// copyEntry is file or folder of recursive copy source.
+type copyEntry struct {
+	name    string    // Slash separated name, folders end with '/'
+	size    int64     // File size
+	modTime time.Time // File modification time
+	etag    string    // S3 object ETag
+}
+
+// copyFolder copys all files of source folder to target folder in
+// opt.Workers concurrent copies and adds them to summary. The folders are
+// created before files.
+func copyFolder(src, dst copyArg, opt *CopyWithOptions, sum *summary) (
+	err error) {
+
+	// Get source files and folders
+	entries, err := listFolder(opt.Context, src)
+	if err != nil {
+		log.Println("error", err)
+		return
+	}
+
+	// Create target folders and count files size
+	var total int64
+	var files []copyEntry
+	for _, e := range append([]copyEntry{{name: ""}}, entries...) {
+		name := filepath.FromSlash(e.name)
+		if !dst.s3 && name != "" && !filepath.IsLocal(name) {
+			sum.fail(src.join(e.name).name, errors.New("invalid file name"))
+			continue
+		}
+		if e.name != "" && !isFolder(e.name) {
+			files = append(files, e)
+			total += e.size
+			continue
+		}
+		target := dst.join(e.name)
+		if err := makeFolder(target, opt); err != nil {
+			sum.fail(target.name, err)
+		}
+	}
+
+	// Start workers
+	p := newProgress(src.name, total, opt.Progress, opt.ProgressInterval)
+	var wg sync.WaitGroup
+	jobs := make(chan copyEntry)
+	for range opt.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				target := dst.join(e.name)
+				err := makeParent(target)
+				if err == nil {
+					_, err = copyFile(src.join(e.name), target, opt, p,
+						nil)
+				}
 				if err != nil {
-					logError(err)
-					return
+					sum.fail(target.name, err)
+					continue
 				}
-				logGet(args[i])
-				continue
+				sum.done(minio.ObjectInfo{Key: target.key, Size: e.size})
 			}
+		}()
+	}
 
-			// Save source to file
-			fo, err := os.Create(key)
-			if err != nil {
-				logError(err)
-				return err
+	// Send files to workers until context canceled
+send:
+	for _, e := range files {
+		select {
+		case jobs <- e:
+		case <-opt.Context.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err = opt.Context.Err(); err == nil {
+		p.finish()
+	}
+	return
+}
+
+// listFolder returns files and folders of source s3 folder or local
+// directory.
+func listFolder(ctx context.Context, src copyArg) (entries []copyEntry,
+	err error) {
+
+	// List S3 folder
+	if src.s3 {
+		prefix := folderKey(src.key)
+		listOpt := src.con.getListOptions(prefix, &ListOptions{Context: ctx})
+		listOpt.Recursive = true
+		var listed bool
+		err = src.con.listObjects(listOpt, func(obj minio.ObjectInfo) bool {
+			listed = true
+			if name := strings.TrimPrefix(obj.Key, prefix); name != "" {
+				entries = append(entries, copyEntry{name, obj.Size,
+					obj.LastModified, obj.ETag})
 			}
-			bufio.NewWriter(fo).ReadFrom(sourceObj)
-			fo.Close()
-			logGet(args[i])
+			return true
+		})
+		if err == nil && !listed {
+			err = fmt.Errorf("%w: %s", ErrNotFound, src.name)
+		}
+		return
+	}
+
+	// List local directory. The symbolic links to files are copied as files,
+	// other not regular files are skipped.
+	err = filepath.WalkDir(src.key, func(path string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(src.key, path)
+		if err != nil || name == "." {
+			return err
+		}
+		name = filepath.ToSlash(name)
+
+		if d.IsDir() {
+			entries = append(entries, copyEntry{name: name + "/"})
+			return nil
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			entries = append(entries, copyEntry{name, info.Size(),
+				info.ModTime(), ""})
 		}
+		return nil
+	})
+	return
+}
+
+// makeFolder creates target s3 folder or local directory. The root s3 folder
+// is not created.
+func makeFolder(dst copyArg, opt *CopyWithOptions) error {
+	if !dst.s3 {
+		return os.MkdirAll(dst.key, 0755)
+	}
+	key := folderKey(dst.key)
+	if key == "" || key == "/" {
+		return nil
+	}
+	return dst.con.Set(key, nil, &SetOptions{Context: opt.Context})
+}
+
+// saveFile saves data of reader to file name. The data is written to
+// temporary file in the same directory, which is synced and renamed to name
+// after the verify function checked written data size n. So the existing
+// file is never replaced by incomplete or corrupted data. The existing not
+// regular file, f.e. /dev/null, is written directly.
+func saveFile(name string, reader io.Reader, verify func(n int64) error) (
+	err error) {
+
+	// Write not regular file
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(name); err == nil {
+		if !info.Mode().IsRegular() {
+			return writeFile(name, reader, verify)
+		}
+		mode = info.Mode().Perm()
+	}
+
+	// Create temporary file which is removed on error
+	dir := filepath.Dir(name)
+	f, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	if err = f.Chmod(mode); err != nil {
+		return
+	}
+
+	// Write, verify and sync data
+	n, err := io.Copy(f, reader)
+	if err != nil {
+		return
+	}
+	if err = verify(n); err != nil {
+		return
+	}
+	if err = f.Sync(); err != nil {
+		return
+	}
+	if err = f.Close(); err != nil {
+		return
 	}
 
+	// Rename temporary file and sync directory to save renamed file
+	if err = os.Rename(f.Name(), name); err != nil {
+		return
+	}
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
 	return
 }
+
+// writeFile writes data of reader to existing file name and checks written
+// data size n by verify function.
+func writeFile(name string, reader io.Reader, verify func(n int64) error) (
+	err error) {
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return
+	}
+	n, err := io.Copy(f, reader)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	return verify(n)
+}
+
+// makeParent creates parent directory of target file. The s3 folders are
+// not created as they are not required to save s3 object.
+func makeParent(dst copyArg) error {
+	if dst.s3 {
+		return nil
+	}
+	return os.MkdirAll(filepath.Dir(dst.key), 0755)
+}
+
+// countReader is reader which counts read bytes.
+type countReader struct {
+	io.Reader
+	n int64
+}
+
+// Read reads data from reader and counts it.
+func (r *countReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	r.n += int64(n)
+	return
+}
+
+// contextReader is reader which returns context error after the context is
+// canceled.
+type contextReader struct {
+	ctx context.Context
+	io.Reader
+}
+
+// Read reads data from reader if context is not canceled.
+func (r *contextReader) Read(p []byte) (n int, err error) {
+	if err = r.ctx.Err(); err != nil {
+		return
+	}
+	return r.Reader.Read(p)
+}
@@ -0,0 +1,490 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/teonet-go/teos3"
+	"github.com/teonet-go/teos3/teos3test"
+)
+
+// writeFiles writes files by slash separated names relative to dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, data := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// setObjects sets s3 objects by keys.
+func setObjects(t *testing.T, con *teos3.TeoS3, objects map[string]string) {
+	t.Helper()
+
+	for key, data := range objects {
+		if err := con.Set(key, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// readFiles returns files of dir by slash separated names relative to dir.
+func readFiles(t *testing.T, dir string) map[string]string {
+	t.Helper()
+
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(name string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, name)
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// readObjects returns s3 objects of all buckets of con by keys, the keys of
+// objects which are not in con bucket have 's3://bucket/' prefix. The
+// folders are skipped.
+func readObjects(t *testing.T, con *teos3.TeoS3) map[string]string {
+	t.Helper()
+
+	buckets, err := con.ListBuckets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := make(map[string]string)
+	for _, bucket := range buckets {
+		b := con.WithBucket(bucket.Name)
+		for key, err := range b.Keys("", &teos3.ListOptions{
+			ListObjectsOptions: teos3.ListObjectsOptions{Recursive: true},
+		}) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.HasSuffix(key, "/") {
+				continue
+			}
+			name := key
+			if bucket.Name != con.Bucket() {
+				name = "s3://" + bucket.Name + "/" + key
+			}
+			objects[name] = string(get(t, b, key))
+		}
+	}
+	return objects
+}
+
+func TestCopyWithRecursive(t *testing.T) {
+	files := map[string]string{"src/a.txt": "a", "src/sub/b.txt": "bb"}
+	objects := map[string]string{"photos/a.jpg": "a",
+		"photos/2023/b.jpg": "bb"}
+
+	tests := []struct {
+		name        string
+		files       map[string]string // Local files before copy
+		objects     map[string]string // S3 objects before copy
+		args        []string          // '{dir}' is replaced with files dir
+		recursive   bool
+		wantFiles   map[string]string // Local files after copy
+		wantObjects map[string]string // S3 objects after copy
+		copied      int64             // Number of copied files
+		size        int64             // Size of copied files
+		err         bool
+	}{
+		{name: "upload directory", files: files,
+			args:      []string{"{dir}/src", "s3:backup/"},
+			recursive: true, wantFiles: files,
+			wantObjects: map[string]string{"backup/a.txt": "a",
+				"backup/sub/b.txt": "bb"},
+			copied: 2, size: 3},
+		{name: "download folder", objects: objects,
+			args:      []string{"s3:photos/", "{dir}/dst"},
+			recursive: true,
+			wantFiles: map[string]string{"dst/a.jpg": "a",
+				"dst/2023/b.jpg": "bb"},
+			wantObjects: objects, copied: 2, size: 3},
+		{name: "download folder without slash", objects: objects,
+			args:      []string{"s3:photos", "{dir}/dst"},
+			recursive: true,
+			wantFiles: map[string]string{"dst/a.jpg": "a",
+				"dst/2023/b.jpg": "bb"},
+			wantObjects: objects, copied: 2, size: 3},
+		{name: "download object", objects: objects,
+			args:        []string{"s3:photos/a.jpg", "{dir}/a.jpg"},
+			recursive:   true,
+			wantFiles:   map[string]string{"a.jpg": "a"},
+			wantObjects: objects, copied: 1, size: 1},
+		{name: "directory without recursive", files: files,
+			args: []string{"{dir}/src", "s3:backup/"}, wantFiles: files,
+			wantObjects: map[string]string{}, err: true},
+	}
+	for _, tt := range tests {
+		for backend, con := range connections(t, nil) {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				writeFiles(t, dir, tt.files)
+				setObjects(t, con, tt.objects)
+
+				var sum teos3.Summary
+				err := teos3.CopyWith(con, dirArgs(dir, tt.args...),
+					&teos3.CopyWithOptions{Recursive: tt.recursive,
+						Summary: &sum})
+				switch {
+				case tt.err && err == nil:
+					t.Fatal("copy error is not returned")
+				case !tt.err && err != nil:
+					t.Fatal(err)
+				}
+
+				if got := readFiles(t, dir); !maps.Equal(got, tt.wantFiles) {
+					t.Fatalf("got files %v, want %v", got, tt.wantFiles)
+				}
+				got := readObjects(t, con)
+				if !maps.Equal(got, tt.wantObjects) {
+					t.Fatalf("got objects %v, want %v", got, tt.wantObjects)
+				}
+				if sum.Objects != tt.copied || sum.Bytes != tt.size {
+					t.Fatalf("got %d copied files of %d bytes, want %d of "+
+						"%d", sum.Objects, sum.Bytes, tt.copied, tt.size)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyWithSources(t *testing.T) {
+	files := map[string]string{"a.txt": "a", "b.txt": "bb"}
+	objects := map[string]string{"docs/a.txt": "a", "docs/b.txt": "bb"}
+
+	tests := []struct {
+		name        string
+		files       map[string]string // Local files before copy
+		objects     map[string]string // S3 objects before copy
+		args        []string          // '{dir}' is replaced with files dir
+		recursive   bool
+		wantFiles   map[string]string // Local files after copy
+		wantObjects map[string]string // S3 objects after copy
+		copied      int64             // Number of copied files
+		size        int64             // Size of copied files
+		err         bool
+	}{
+		{name: "files to folder", files: files,
+			args:      []string{"{dir}/a.txt", "{dir}/b.txt", "s3:docs/"},
+			wantFiles: files, wantObjects: objects, copied: 2, size: 3},
+		{name: "objects to directory", objects: objects,
+			files: map[string]string{"out/c.txt": "c"},
+			args:  []string{"s3:docs/a.txt", "s3:docs/b.txt", "{dir}/out"},
+			wantFiles: map[string]string{"out/a.txt": "a", "out/b.txt": "bb",
+				"out/c.txt": "c"},
+			wantObjects: objects, copied: 2, size: 3},
+		{name: "file and object to folder", objects: objects,
+			files:     map[string]string{"c.txt": "c"},
+			args:      []string{"{dir}/c.txt", "s3:docs/a.txt", "s3:copy/"},
+			wantFiles: map[string]string{"c.txt": "c"},
+			wantObjects: map[string]string{"docs/a.txt": "a",
+				"docs/b.txt": "bb", "copy/a.txt": "a", "copy/c.txt": "c"},
+			copied: 2, size: 2},
+		{name: "object to another bucket", objects: objects,
+			args:      []string{"s3:docs/a.txt", "s3://archive/docs/"},
+			wantFiles: map[string]string{},
+			wantObjects: map[string]string{"docs/a.txt": "a",
+				"docs/b.txt": "bb", "s3://archive/docs/a.txt": "a"},
+			copied: 1, size: 1},
+		{name: "folder to another bucket", objects: objects,
+			args:      []string{"s3:docs/", "s3://archive/"},
+			recursive: true,
+			wantFiles: map[string]string{},
+			wantObjects: map[string]string{"docs/a.txt": "a",
+				"docs/b.txt": "bb", "s3://archive/a.txt": "a",
+				"s3://archive/b.txt": "bb"},
+			copied: 2, size: 3},
+		{name: "several sources to file", files: files,
+			args:      []string{"{dir}/a.txt", "{dir}/b.txt", "s3:docs/c.txt"},
+			wantFiles: files, wantObjects: map[string]string{}, err: true},
+	}
+	for _, tt := range tests {
+		for backend, con := range connections(t, nil) {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				writeFiles(t, dir, tt.files)
+				setObjects(t, con, tt.objects)
+
+				var sum teos3.Summary
+				err := teos3.CopyWith(con, dirArgs(dir, tt.args...),
+					&teos3.CopyWithOptions{Recursive: tt.recursive,
+						Summary: &sum})
+				switch {
+				case tt.err && err == nil:
+					t.Fatal("copy error is not returned")
+				case !tt.err && err != nil:
+					t.Fatal(err)
+				}
+
+				if got := readFiles(t, dir); !maps.Equal(got, tt.wantFiles) {
+					t.Fatalf("got files %v, want %v", got, tt.wantFiles)
+				}
+				got := readObjects(t, con)
+				if !maps.Equal(got, tt.wantObjects) {
+					t.Fatalf("got objects %v, want %v", got, tt.wantObjects)
+				}
+				if sum.Objects != tt.copied || sum.Bytes != tt.size {
+					t.Fatalf("got %d copied files of %d bytes, want %d of "+
+						"%d", sum.Objects, sum.Bytes, tt.copied, tt.size)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyWithStd(t *testing.T) {
+	objects := map[string]string{"docs/a.txt": "a", "docs/b.txt": "bb"}
+
+	tests := []struct {
+		name        string
+		files       map[string]string // Local files before copy
+		objects     map[string]string // S3 objects before copy
+		stdin       string
+		args        []string // '{dir}' is replaced with files dir
+		recursive   bool
+		wantFiles   map[string]string // Local files after copy
+		wantObjects map[string]string // S3 objects after copy
+		wantStdout  string
+		copied      int64 // Number of copied files
+		size        int64 // Size of copied files
+		err         bool
+	}{
+		{name: "stdin to object", stdin: "stdin",
+			args: []string{"-", "s3:in.txt"}, wantFiles: map[string]string{},
+			wantObjects: map[string]string{"in.txt": "stdin"}, copied: 1,
+			size: 5},
+		{name: "stdin to file", stdin: "stdin",
+			args:        []string{"-", "{dir}/in.txt"},
+			wantFiles:   map[string]string{"in.txt": "stdin"},
+			wantObjects: map[string]string{}, copied: 1, size: 5},
+		{name: "object to stdout", objects: objects,
+			args: []string{"s3:docs/b.txt", "-"}, wantFiles: map[string]string{},
+			wantObjects: objects, wantStdout: "bb", copied: 1, size: 2},
+		{name: "file to stdout",
+			files:       map[string]string{"a.txt": "a"},
+			args:        []string{"{dir}/a.txt", "-"},
+			wantFiles:   map[string]string{"a.txt": "a"},
+			wantObjects: map[string]string{}, wantStdout: "a", copied: 1,
+			size: 1},
+		{name: "stdin to folder", stdin: "stdin",
+			args: []string{"-", "s3:docs/"}, wantFiles: map[string]string{},
+			wantObjects: map[string]string{}, err: true},
+		{name: "folder to stdout", objects: objects,
+			args:      []string{"s3:docs/", "-"},
+			recursive: true,
+			wantFiles: map[string]string{}, wantObjects: objects, err: true},
+	}
+	for _, tt := range tests {
+		for backend, con := range connections(t, nil) {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				writeFiles(t, dir, tt.files)
+				setObjects(t, con, tt.objects)
+
+				var sum teos3.Summary
+				var stdout strings.Builder
+				err := teos3.CopyWith(con, dirArgs(dir, tt.args...),
+					&teos3.CopyWithOptions{Recursive: tt.recursive,
+						Summary: &sum, Stdin: strings.NewReader(tt.stdin),
+						Stdout: &stdout})
+				switch {
+				case tt.err && err == nil:
+					t.Fatal("copy error is not returned")
+				case !tt.err && err != nil:
+					t.Fatal(err)
+				}
+
+				if got := readFiles(t, dir); !maps.Equal(got, tt.wantFiles) {
+					t.Fatalf("got files %v, want %v", got, tt.wantFiles)
+				}
+				got := readObjects(t, con)
+				if !maps.Equal(got, tt.wantObjects) {
+					t.Fatalf("got objects %v, want %v", got, tt.wantObjects)
+				}
+				if got := stdout.String(); got != tt.wantStdout {
+					t.Fatalf("got stdout %q, want %q", got, tt.wantStdout)
+				}
+				if sum.Objects != tt.copied || sum.Bytes != tt.size {
+					t.Fatalf("got %d copied files of %d bytes, want %d of "+
+						"%d", sum.Objects, sum.Bytes, tt.copied, tt.size)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyWithProgress(t *testing.T) {
+	const size = 1 << 20
+	data := strings.Repeat("0123456789abcdef", size/16)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"upload", []string{"{dir}/src", "s3:dst"}},
+		{"download", []string{"s3:src", "{dir}/dst"}},
+	}
+
+	for backend, con := range connections(t, nil) {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				writeFiles(t, dir, map[string]string{"src": data})
+				if err := con.Set("src", []byte(data)); err != nil {
+					t.Fatal(err)
+				}
+
+				// The progress function is called sequentially
+				var progress []teos3.Progress
+				err := teos3.CopyWith(con, dirArgs(dir, tt.args...),
+					&teos3.CopyWithOptions{
+						Progress: func(p teos3.Progress) {
+							progress = append(progress, p)
+						},
+						ProgressInterval: time.Nanosecond,
+					})
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// The progress totals are monotonic and the last progress
+				// is finished
+				if len(progress) < 2 {
+					t.Fatalf("got %d progress calls", len(progress))
+				}
+				for i, p := range progress {
+					last := i == len(progress)-1
+					switch {
+					case p.Total != size:
+						t.Fatalf("got total %d, want %d", p.Total, size)
+					case i > 0 && p.Done < progress[i-1].Done:
+						t.Fatalf("got done %d after %d", p.Done,
+							progress[i-1].Done)
+					case p.Finished != last:
+						t.Fatalf("got finished %v in progress %d of %d",
+							p.Finished, i+1, len(progress))
+					case last && p.Done != size:
+						t.Fatalf("got finished done %d, want %d", p.Done,
+							size)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCopyWithCancel(t *testing.T) {
+	// The object is uploaded by multipart upload
+	const size = 20 << 20
+	data := strings.Repeat("0123456789abcdef", size/16)
+
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"upload", []string{"{dir}/src", "s3:dst"}},
+		{"download", []string{"s3:src", "{dir}/dst"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := teos3test.NewServer()
+			defer srv.Close()
+			con, err := srv.Connect()
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"src": data})
+			if err := con.Set("src", []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+
+			// Cancel copy when first data copied
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			err = teos3.CopyWith(con, dirArgs(dir, tt.args...),
+				&teos3.CopyWithOptions{
+					Context: ctx,
+					Progress: func(p teos3.Progress) {
+						if p.Done > 0 {
+							cancel()
+						}
+					},
+					ProgressInterval: time.Nanosecond,
+				})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("got error %v, want %v", err, context.Canceled)
+			}
+
+			// No partial target file, object or multipart upload is left
+			want := map[string]string{"src": data}
+			if got := readFiles(t, dir); !maps.Equal(got, want) {
+				t.Fatalf("got files %v, want only src", slices.Collect(
+					maps.Keys(got)))
+			}
+			if got := readObjects(t, con); !maps.Equal(got, want) {
+				t.Fatalf("got objects %v, want only src", slices.Collect(
+					maps.Keys(got)))
+			}
+			core, err := minio.NewCore(srv.Endpoint(), &minio.Options{
+				Creds: credentials.NewStaticV4(teos3test.AccessKey,
+					teos3test.SecretKey, ""),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			uploads, err := core.ListMultipartUploads(context.Background(),
+				con.Bucket(), "", "", "", "", 0)
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case len(uploads.Uploads) != 0:
+				t.Fatalf("got incomplete uploads %v", uploads.Uploads)
+			}
+		})
+	}
+}
+
+// dirArgs returns arguments with '{dir}' replaced by dir.
+func dirArgs(dir string, args ...string) (dirArgs []string) {
+	for _, arg := range args {
+		dirArgs = append(dirArgs, strings.ReplaceAll(arg, "{dir}", dir))
+	}
+	return
+}
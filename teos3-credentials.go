@@ -0,0 +1,201 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package credentials module.
+
+package teos3
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// CredentialsOptions contains credentials chain options.
+type CredentialsOptions struct {
+
+	// AccessKey, SecretKey and SessionToken are explicit credentials which
+	// are used first if AccessKey and SecretKey are set.
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+
+	// Profile is the AWS shared credentials and config files profile. The
+	// TEOS3_PROFILE, AWS_PROFILE environment variables or 'default' profile
+	// is used if Profile is empty.
+	Profile string
+
+	// TokenFile is the session token file in the AWS credential_process JSON
+	// format. The TEOS3_TOKENFILE environment variable is used if TokenFile
+	// is empty.
+	TokenFile string
+}
+
+// tokenExpiryWindow is the time before the session token expiration when
+// the token file is re-read.
+const tokenExpiryWindow = time.Minute
+
+// NewCredentials creates credentials chain which gets credentials from the
+// first of next providers which returns access and secret keys:
+//
+//   - explicit AccessKey, SecretKey and SessionToken options;
+//   - TEOS3_ACCESSKEY, TEOS3_SECRETKEY and TEOS3_SESSIONTOKEN environment
+//     variables;
+//   - AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+//     environment variables;
+//   - AWS shared credentials file profile (AWS_SHARED_CREDENTIALS_FILE or
+//     ~/.aws/credentials);
+//   - AWS shared config file profile (AWS_CONFIG_FILE or ~/.aws/config);
+//   - session token file which is re-read when the token expires or the
+//     file changes.
+//
+// The anonymous credentials are used if no one provider returns keys.
+func NewCredentials(opt CredentialsOptions) *credentials.Credentials {
+
+	// Get profile
+	profile := opt.Profile
+	for _, env := range []string{"TEOS3_PROFILE", "AWS_PROFILE"} {
+		if profile == "" {
+			profile = os.Getenv(env)
+		}
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	// Get token file
+	tokenFile := opt.TokenFile
+	if tokenFile == "" {
+		tokenFile = os.Getenv("TEOS3_TOKENFILE")
+	}
+
+	providers := []credentials.Provider{
+		&credentials.Static{Value: credentials.Value{
+			AccessKeyID:     opt.AccessKey,
+			SecretAccessKey: opt.SecretKey,
+			SessionToken:    opt.SessionToken,
+			SignerType:      credentials.SignatureV4,
+		}},
+		&credentials.Static{Value: credentials.Value{
+			AccessKeyID:     os.Getenv("TEOS3_ACCESSKEY"),
+			SecretAccessKey: os.Getenv("TEOS3_SECRETKEY"),
+			SessionToken:    os.Getenv("TEOS3_SESSIONTOKEN"),
+			SignerType:      credentials.SignatureV4,
+		}},
+		&credentials.EnvAWS{},
+		&credentials.FileAWSCredentials{Profile: profile},
+		&credentials.FileAWSCredentials{
+			Filename: awsConfigFile(),
+			Profile:  awsConfigProfile(profile),
+		},
+	}
+	if tokenFile != "" {
+		providers = append(providers, &tokenFileProvider{filename: tokenFile})
+	}
+
+	return credentials.NewChainCredentials(providers)
+}
+
+// awsConfigFile returns AWS shared config file name.
+func awsConfigFile() string {
+	if name := os.Getenv("AWS_CONFIG_FILE"); name != "" {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", "config")
+}
+
+// awsConfigProfile returns AWS shared config file section name of profile.
+func awsConfigProfile(profile string) string {
+	if profile == "default" {
+		return profile
+	}
+	return "profile " + profile
+}
+
+// tokenFileProvider is credentials provider which reads session token file
+// in the AWS credential_process JSON format:
+//
+//	{
+//		"Version": 1,
+//		"AccessKeyId": "...",
+//		"SecretAccessKey": "...",
+//		"SessionToken": "...",
+//		"Expiration": "2023-01-01T00:00:00Z"
+//	}
+//
+// The file is re-read when the token expires or the file modification time
+// changes.
+type tokenFileProvider struct {
+	filename   string
+	mut        sync.Mutex
+	modTime    time.Time
+	expiration time.Time
+}
+
+// tokenFile is session token file content.
+type tokenFile struct {
+	Version         int
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      time.Time
+}
+
+// Retrieve reads session token file.
+func (p *tokenFileProvider) Retrieve() (value credentials.Value, err error) {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	info, err := os.Stat(p.filename)
+	if err != nil {
+		return
+	}
+	data, err := os.ReadFile(p.filename)
+	if err != nil {
+		return
+	}
+	var token tokenFile
+	if err = json.Unmarshal(data, &token); err != nil {
+		return
+	}
+
+	p.modTime, p.expiration = info.ModTime(), token.Expiration
+	value = credentials.Value{
+		AccessKeyID:     token.AccessKeyID,
+		SecretAccessKey: token.SecretAccessKey,
+		SessionToken:    token.SessionToken,
+		Expiration:      token.Expiration,
+		SignerType:      credentials.SignatureV4,
+	}
+	return
+}
+
+// RetrieveWithCredContext reads session token file, the cred context is not
+// used.
+func (p *tokenFileProvider) RetrieveWithCredContext(
+	_ *credentials.CredContext) (credentials.Value, error) {
+	return p.Retrieve()
+}
+
+// IsExpired returns true if the session token expires or the token file
+// changes.
+func (p *tokenFileProvider) IsExpired() bool {
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	if !p.expiration.IsZero() &&
+		time.Now().Add(tokenExpiryWindow).After(p.expiration) {
+		return true
+	}
+	info, err := os.Stat(p.filename)
+	return err != nil || !info.ModTime().Equal(p.modTime)
+}
@@ -0,0 +1,181 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/teonet-go/teos3"
+)
+
+// clearCredentialsEnv clears credentials environment variables and sets
+// AWS shared files to not existing files in temporary directory.
+func clearCredentialsEnv(t *testing.T) (dir string) {
+	dir = t.TempDir()
+	for _, env := range []string{
+		"TEOS3_ACCESSKEY", "TEOS3_SECRETKEY", "TEOS3_SESSIONTOKEN",
+		"TEOS3_PROFILE", "TEOS3_TOKENFILE",
+		"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY",
+		"AWS_SECRET_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE",
+	} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("HOME", dir)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	return
+}
+
+// writeTokenFile writes session token file with access key and expiration
+// and sets its modification time.
+func writeTokenFile(t *testing.T, name, accessKey string,
+	expiration, modTime time.Time) {
+
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{
+		"Version":         1,
+		"AccessKeyId":     accessKey,
+		"SecretAccessKey": "secret",
+		"SessionToken":    "token",
+		"Expiration":      expiration,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(name, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeProfile writes AWS shared file with profile section and access key.
+func writeProfile(t *testing.T, name, section, accessKey string) {
+	t.Helper()
+
+	data := fmt.Sprintf("[%s]\naws_access_key_id = %s\n"+
+		"aws_secret_access_key = secret\n", section, accessKey)
+	if err := os.WriteFile(name, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCredentialsChain(t *testing.T) {
+
+	// The credentials sources in order of precedence, each source sets
+	// access key to its name
+	sources := []struct {
+		name string
+		set  func(t *testing.T, dir string, opt *teos3.CredentialsOptions)
+	}{
+		{"explicit", func(t *testing.T, dir string,
+			opt *teos3.CredentialsOptions) {
+			opt.AccessKey, opt.SecretKey = "explicit", "secret"
+		}},
+		{"teos3", func(t *testing.T, dir string,
+			opt *teos3.CredentialsOptions) {
+			t.Setenv("TEOS3_ACCESSKEY", "teos3")
+			t.Setenv("TEOS3_SECRETKEY", "secret")
+		}},
+		{"aws", func(t *testing.T, dir string,
+			opt *teos3.CredentialsOptions) {
+			t.Setenv("AWS_ACCESS_KEY_ID", "aws")
+			t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+		}},
+		{"shared", func(t *testing.T, dir string,
+			opt *teos3.CredentialsOptions) {
+			writeProfile(t, filepath.Join(dir, "credentials"), "test",
+				"shared")
+		}},
+		{"profile", func(t *testing.T, dir string,
+			opt *teos3.CredentialsOptions) {
+			writeProfile(t, filepath.Join(dir, "config"), "profile test",
+				"profile")
+		}},
+		{"token", func(t *testing.T, dir string,
+			opt *teos3.CredentialsOptions) {
+			opt.TokenFile = filepath.Join(dir, "token")
+			writeTokenFile(t, opt.TokenFile, "token",
+				time.Now().Add(time.Hour), time.Now())
+		}},
+	}
+
+	// The first set source is used
+	for i := range len(sources) + 1 {
+		name, want := "anonymous", ""
+		if i < len(sources) {
+			name, want = sources[i].name, sources[i].name
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := clearCredentialsEnv(t)
+			t.Setenv("TEOS3_PROFILE", "test")
+			var opt teos3.CredentialsOptions
+			for _, source := range sources[i:] {
+				source.set(t, dir, &opt)
+			}
+
+			value, err := teos3.NewCredentials(opt).Get()
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case value.AccessKeyID != want:
+				t.Fatalf("got access key %q, want %q", value.AccessKeyID,
+					want)
+			}
+		})
+	}
+}
+
+func TestCredentialsTokenFile(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+
+	tests := []struct {
+		name       string
+		expiration time.Time // expiration of the first token
+		modTime    time.Time // modification time of rewritten file
+		want       string
+	}{
+		{"not changed", now.Add(time.Hour), now, "first"},
+		{"file changed", now.Add(time.Hour), now.Add(time.Second), "second"},
+		{"token expires", now.Add(time.Second), now, "second"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := clearCredentialsEnv(t)
+			name := filepath.Join(dir, "token")
+			t.Setenv("TEOS3_TOKENFILE", name)
+
+			writeTokenFile(t, name, "first", tt.expiration, now)
+			creds := teos3.NewCredentials(teos3.CredentialsOptions{})
+			value, err := creds.Get()
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case value.AccessKeyID != "first":
+				t.Fatalf("got access key %q, want first", value.AccessKeyID)
+			}
+
+			// The token file is re-read if it changes or the token expires
+			writeTokenFile(t, name, "second", now.Add(time.Hour),
+				tt.modTime)
+			value, err = creds.Get()
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case value.AccessKeyID != tt.want:
+				t.Fatalf("got access key %q, want %s", value.AccessKeyID,
+					tt.want)
+			}
+		})
+	}
+}
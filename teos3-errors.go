@@ -0,0 +1,148 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package errors module.
+
+package teos3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// TeoS3 errors. The S3 errors returned by TeoS3 methods wrap one of this
+// errors, so errors.Is may be used to check them:
+//
+//	data, err := con.Get(key)
+//	if errors.Is(err, teos3.ErrNotFound) {
+//		// The key does not exist
+//	}
+var (
+	ErrDestinationObjectAlreadyExists = errors.New(
+		"destination object already exists",
+	)
+	ErrNotFound           = errors.New("not found")
+	ErrBucketNotFound     = errors.New("bucket not found")
+	ErrBucketExists       = errors.New("bucket already exists")
+	ErrBucketNotEmpty     = errors.New("bucket not empty")
+	ErrAccessDenied       = errors.New("access denied")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrThrottled          = errors.New("throttled")
+	ErrSyncConflict       = errors.New("file changed on both sides")
+	ErrChecksumMismatch   = errors.New("checksum mismatch")
+	ErrChecksumNotStored  = errors.New("object uploaded, checksum not stored")
+)
+
+// S3 error codes by TeoS3 errors
+var errorCodes = map[string]error{
+	"NoSuchKey":                  ErrNotFound,
+	"NoSuchVersion":              ErrNotFound,
+	"NoSuchUpload":               ErrNotFound,
+	"NoSuchBucket":               ErrBucketNotFound,
+	"BucketAlreadyExists":        ErrBucketExists,
+	"BucketAlreadyOwnedByYou":    ErrBucketExists,
+	"BucketNotEmpty":             ErrBucketNotEmpty,
+	"AccessDenied":               ErrAccessDenied,
+	"AllAccessDisabled":          ErrAccessDenied,
+	"InvalidAccessKeyId":         ErrAccessDenied,
+	"SignatureDoesNotMatch":      ErrAccessDenied,
+	"ExpiredToken":               ErrAccessDenied,
+	"InvalidToken":               ErrAccessDenied,
+	"PreconditionFailed":         ErrPreconditionFailed,
+	"ConditionalRequestConflict": ErrPreconditionFailed,
+	"BadDigest":                  ErrChecksumMismatch,
+	"SlowDown":                   ErrThrottled,
+	"SlowDownRead":               ErrThrottled,
+	"SlowDownWrite":              ErrThrottled,
+	"Throttling":                 ErrThrottled,
+	"ThrottlingException":        ErrThrottled,
+	"RequestLimitExceeded":       ErrThrottled,
+	"TooManyRequests":            ErrThrottled,
+}
+
+// S3 error codes of temporary server errors
+var retryableCodes = map[string]bool{
+	"InternalError":        true,
+	"ServiceUnavailable":   true,
+	"RequestTimeout":       true,
+	"RequestTimeTooSkewed": true,
+	"OperationAborted":     true,
+}
+
+// wrapError wraps S3 error with TeoS3 error which matches the S3 error code
+// or HTTP status code.
+func wrapError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errResp minio.ErrorResponse
+	if !errors.As(err, &errResp) {
+		return err
+	}
+
+	// Get TeoS3 error by S3 error code or by HTTP status code
+	e, ok := errorCodes[errResp.Code]
+	if !ok {
+		switch errResp.StatusCode {
+		case http.StatusNotFound:
+			e = ErrNotFound
+		case http.StatusForbidden:
+			e = ErrAccessDenied
+		case http.StatusPreconditionFailed:
+			e = ErrPreconditionFailed
+		case http.StatusTooManyRequests:
+			e = ErrThrottled
+		default:
+			return err
+		}
+	}
+	if errors.Is(err, e) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", e, err)
+}
+
+// IsRetryable returns true if the operation failed with err may succeed when
+// retried: request was throttled, server failed with temporary error or
+// network error occurred. Context cancellation errors are not retryable.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		return false
+	case errors.Is(err, ErrThrottled),
+		errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, syscall.ECONNREFUSED),
+		errors.Is(err, syscall.EPIPE):
+		return true
+	}
+
+	// S3 server errors
+	var errResp minio.ErrorResponse
+	if errors.As(err, &errResp) {
+		return retryableCodes[errResp.Code] ||
+			errResp.StatusCode >= http.StatusInternalServerError
+	}
+
+	// Network errors
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// IsPermanent returns true if the operation failed with err will fail again
+// when retried.
+func IsPermanent(err error) bool {
+	return err != nil && !IsRetryable(err)
+}
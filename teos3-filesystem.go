@@ -0,0 +1,742 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package local file system backend module.
+
+package teos3
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// FileSystem is Backend which stores objects in local directory. Buckets are
+// mapped to root subdirectories, keys are mapped to files and folder keys
+// (ending with '/') are mapped to directories. Buckets are created by
+// MakeBucket or on first write. Objects metadata is saved in sidecar files
+// with '.teos3meta' suffix. Objects are written to temporary files and
+// renamed into place, so interrupted write never leaves half written value.
+// The sidecar file is written before the object file is renamed and contains
+// its size and modification time, so the sidecar of interrupted write is
+// detected. The sidecar keeps the metadata of previous object file too, which
+// is used after interrupted write. If the object file matches neither of them
+// the sidecar metadata is kept and the ETag is calculated from object file.
+//
+// The file system can't contain file and directory with the same name, so
+// keys like 'a' and 'a/b' can't be saved in one bucket.
+type FileSystem struct {
+	root string
+	mut  sync.RWMutex
+	wmut sync.RWMutex // serializes objects commit and objects read
+}
+
+// FileSystem backend reserved file names
+const (
+	fsMetaSuffix = ".teos3meta"
+	fsTempPrefix = ".teos3tmp-"
+)
+
+// fsMeta is FileSystem object metadata saved in sidecar file.
+type fsMeta struct {
+	ETag         string            `json:"etag"`
+	Size         int64             `json:"size,omitempty"`
+	ModTime      time.Time         `json:"mtime,omitzero"`
+	ContentType  string            `json:"content_type,omitempty"`
+	UserMetadata map[string]string `json:"user_metadata,omitempty"`
+	UserTags     map[string]string `json:"user_tags,omitempty"`
+	StorageClass string            `json:"storage_class,omitempty"`
+	Prev         *fsMeta           `json:"prev,omitempty"`
+}
+
+// matches returns true if metadata describes file with stat.
+func (m fsMeta) matches(stat fs.FileInfo) bool {
+	return m.Size == stat.Size() && m.ModTime.Equal(stat.ModTime())
+}
+
+// NewFileSystem creates new local file system Backend in the root directory.
+// The root directory is created if it does not exist.
+func NewFileSystem(root string) (*FileSystem, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &FileSystem{root: root}, nil
+}
+
+// ConnectDir creates new TeoS3 object which uses local file system backend in
+// the root directory and bucket (if omitted then default 'teos3' buckets name
+// used).
+func ConnectDir(root string, buckets ...string) (*TeoS3, error) {
+	backend, err := NewFileSystem(root)
+	if err != nil {
+		return nil, err
+	}
+	return ConnectBackend(backend, buckets...), nil
+}
+
+// PutObject saves object from reader to the bucket by key.
+func (f *FileSystem) PutObject(ctx context.Context, bucket, key string,
+	reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (
+	info minio.UploadInfo, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	meta := fsMeta{
+		ContentType:  opts.ContentType,
+		UserMetadata: userMetadata(opts.UserMetadata),
+		UserTags:     opts.UserTags,
+		StorageClass: opts.StorageClass,
+	}
+	if objectSize >= 0 {
+		reader = io.LimitReader(reader, objectSize)
+	}
+
+	objInfo, err := f.put(bucket, key, reader, objectSize, meta,
+		putPrecondition(opts))
+	if err != nil {
+		return
+	}
+
+	info = uploadInfo(bucket, objInfo)
+	return
+}
+
+// GetObject returns object from the bucket by key.
+func (f *FileSystem) GetObject(ctx context.Context, bucket, key string,
+	opts minio.GetObjectOptions) (Object, error) {
+
+	// Open the object file and read its metadata under lock, so the object
+	// data and metadata are not changed between them
+	f.wmut.RLock()
+	defer f.wmut.RUnlock()
+
+	info, err := f.stat(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	name, _ := f.path(bucket, key)
+	if isFolder(key) {
+		name = os.DevNull
+	}
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, f.error(err, bucket, key)
+	}
+
+	return &fsReader{file, info}, nil
+}
+
+// StatObject returns metadata of object from the bucket by key.
+func (f *FileSystem) StatObject(ctx context.Context, bucket, key string,
+	opts minio.StatObjectOptions) (info minio.ObjectInfo, err error) {
+
+	f.wmut.RLock()
+	defer f.wmut.RUnlock()
+
+	return f.stat(ctx, bucket, key)
+}
+
+// stat returns metadata of object from the bucket by key. It should be
+// called under wmut lock.
+func (f *FileSystem) stat(ctx context.Context, bucket, key string) (
+	info minio.ObjectInfo, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	name, err := f.path(bucket, key)
+	if err != nil {
+		return
+	}
+
+	// Folder key exists if its directory has metadata file
+	stat, err := os.Stat(name + f.folderMeta(key))
+	if err != nil {
+		err = f.error(err, bucket, key)
+		return
+	}
+	if stat.IsDir() {
+		err = errNoSuchKey(bucket, key)
+		return
+	}
+
+	info = f.objectInfo(key, name, stat)
+	return
+}
+
+// RemoveObject removes object from the bucket by key. Removing of not
+// existing object is not an error.
+func (f *FileSystem) RemoveObject(ctx context.Context, bucket, key string,
+	opts minio.RemoveObjectOptions) (err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	name, err := f.path(bucket, key)
+	if err != nil {
+		return
+	}
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+	f.wmut.Lock()
+	defer f.wmut.Unlock()
+
+	// Directory is not an object
+	if !isFolder(key) {
+		if stat, e := os.Stat(name); e == nil && stat.IsDir() {
+			return nil
+		}
+	}
+
+	// Remove folder metadata file or object file and its metadata file
+	if isFolder(key) {
+		err = os.Remove(name + fsMetaSuffix)
+	} else if err = os.Remove(name); err == nil || errors.Is(err, fs.ErrNotExist) {
+		err = os.Remove(name + fsMetaSuffix)
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+
+	// Remove empty directories up to the bucket directory
+	bucketDir := filepath.Join(f.root, bucket)
+	for dir := filepath.Dir(name); dir != bucketDir &&
+		strings.HasPrefix(dir, bucketDir); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+
+	return nil
+}
+
+// RemoveObjects removes objects received from objectsCh channel from the
+// bucket.
+func (f *FileSystem) RemoveObjects(ctx context.Context, bucket string,
+	objectsCh <-chan minio.ObjectInfo,
+	opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+	return removeObjects(ctx, f, bucket, objectsCh, opts)
+}
+
+// ListObjects lists objects of the bucket. Objects are listed in key order.
+// If opts.Recursive is false then keys with '/' after the prefix are grouped
+// to folder keys.
+func (f *FileSystem) ListObjects(ctx context.Context, bucket string,
+	opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+
+	var infos []minio.ObjectInfo
+	err := f.walk(bucket, opts.Prefix, func(info minio.ObjectInfo) {
+		infos = append(infos, info)
+	})
+	if err != nil {
+		objInfo := make(chan minio.ObjectInfo, 1)
+		objInfo <- minio.ObjectInfo{Err: err}
+		close(objInfo)
+		return objInfo
+	}
+
+	return listObjects(ctx, infos, opts)
+}
+
+// CopyObject copies source object to destination object.
+func (f *FileSystem) CopyObject(ctx context.Context, dst minio.CopyDestOptions,
+	src minio.CopySrcOptions) (info minio.UploadInfo, err error) {
+	return f.CopyObjectIf(ctx, dst, src, "", "")
+}
+
+// CopyObjectIf copies source object to destination object if destination
+// object preconditions hold.
+func (f *FileSystem) CopyObjectIf(ctx context.Context,
+	dst minio.CopyDestOptions, src minio.CopySrcOptions, ifMatch,
+	ifNoneMatch string) (info minio.UploadInfo, err error) {
+
+	obj, err := f.GetObject(ctx, src.Bucket, src.Object,
+		minio.GetObjectOptions{})
+	if err != nil {
+		return
+	}
+	defer obj.Close()
+
+	srcInfo, _ := obj.Stat()
+	if err = checkCopySource(src, srcInfo); err != nil {
+		return
+	}
+	objInfo := copyObjectInfo(srcInfo, dst)
+	meta := fsMeta{
+		ContentType:  objInfo.ContentType,
+		UserMetadata: objInfo.UserMetadata,
+		UserTags:     objInfo.UserTags,
+		StorageClass: objInfo.StorageClass,
+	}
+
+	objInfo, err = f.put(dst.Bucket, dst.Object, obj, objInfo.Size, meta,
+		precondition{ifMatch, ifNoneMatch})
+	if err != nil {
+		return
+	}
+
+	info = uploadInfo(dst.Bucket, objInfo)
+	return
+}
+
+// BucketExists returns true if the bucket directory exists.
+func (f *FileSystem) BucketExists(ctx context.Context, bucket string) (
+	ok bool, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = s3utils.CheckValidBucketName(bucket); err != nil {
+		return
+	}
+
+	stat, err := os.Stat(filepath.Join(f.root, bucket))
+	switch {
+	case err == nil:
+		ok = stat.IsDir()
+	case errors.Is(err, fs.ErrNotExist):
+		err = nil
+	}
+	return
+}
+
+// MakeBucket creates new bucket directory.
+func (f *FileSystem) MakeBucket(ctx context.Context, bucket string,
+	opts minio.MakeBucketOptions) (err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = s3utils.CheckValidBucketNameStrict(bucket); err != nil {
+		return
+	}
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	err = os.Mkdir(filepath.Join(f.root, bucket), 0755)
+	if errors.Is(err, fs.ErrExist) {
+		err = errBucketAlreadyOwnedByYou(bucket)
+	}
+	return
+}
+
+// RemoveBucket removes empty bucket directory.
+func (f *FileSystem) RemoveBucket(ctx context.Context, bucket string) (
+	err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if err = s3utils.CheckValidBucketName(bucket); err != nil {
+		return
+	}
+
+	f.mut.Lock()
+	defer f.mut.Unlock()
+
+	err = os.Remove(filepath.Join(f.root, bucket))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		err = errNoSuchBucket(bucket)
+	case errors.Is(err, syscall.ENOTEMPTY), errors.Is(err, syscall.EEXIST):
+		err = errBucketNotEmpty(bucket)
+	}
+	return
+}
+
+// ListBuckets returns list of all bucket directories sorted by name.
+func (f *FileSystem) ListBuckets(ctx context.Context) (
+	buckets []minio.BucketInfo, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	entries, err := os.ReadDir(f.root)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() ||
+			s3utils.CheckValidBucketName(entry.Name()) != nil {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, minio.BucketInfo{
+			Name:         entry.Name(),
+			CreationDate: stat.ModTime().UTC(),
+		})
+	}
+
+	sortBuckets(buckets)
+	return
+}
+
+// put saves data from reader to the file by bucket and key. The data is
+// written to temporary file which renamed to the key file after write. The
+// preconditions are checked before rename.
+func (f *FileSystem) put(bucket, key string, reader io.Reader,
+	objectSize int64, meta fsMeta, cond precondition) (
+	info minio.ObjectInfo, err error) {
+
+	name, err := f.path(bucket, key)
+	if err != nil {
+		return
+	}
+
+	f.mut.RLock()
+	defer f.mut.RUnlock()
+
+	// Create folder directory and its metadata file
+	if isFolder(key) {
+		f.wmut.Lock()
+		defer f.wmut.Unlock()
+		if err = f.check(bucket, key, cond); err != nil {
+			return
+		}
+		if err = os.MkdirAll(name, 0755); err != nil {
+			return
+		}
+		meta.ETag = etag(nil)
+		if err = f.writeMeta(name+fsMetaSuffix, meta); err != nil {
+			return
+		}
+		return f.stat(context.Background(), bucket, key)
+	}
+
+	// Write data to temporary file
+	dir := filepath.Dir(name)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(dir, fsTempPrefix+"*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	n, err := io.Copy(tmp, io.TeeReader(reader, hash))
+	if err == nil && objectSize >= 0 && n != objectSize {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+	stat, err := os.Stat(tmp.Name())
+	if err != nil {
+		return
+	}
+
+	// Write metadata file with temporary file size and modification time
+	// and move temporary file to the key file
+	f.wmut.Lock()
+	defer f.wmut.Unlock()
+	if err = f.check(bucket, key, cond); err != nil {
+		return
+	}
+	meta.ETag = hex.EncodeToString(hash.Sum(nil))
+	meta.Size, meta.ModTime = stat.Size(), stat.ModTime()
+	if prevStat, e := os.Stat(name); e == nil && !prevStat.IsDir() {
+		prev := f.fileMeta(name, prevStat)
+		prev.Size, prev.ModTime = prevStat.Size(), prevStat.ModTime()
+		meta.Prev = &prev
+	}
+	if err = f.writeMeta(name+fsMetaSuffix, meta); err != nil {
+		return
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return
+	}
+
+	return f.stat(context.Background(), bucket, key)
+}
+
+// check returns PreconditionFailed error if object by bucket and key does not
+// match the preconditions.
+func (f *FileSystem) check(bucket, key string, cond precondition) error {
+	if cond == (precondition{}) {
+		return nil
+	}
+	var info *minio.ObjectInfo
+	objInfo, err := f.stat(context.Background(), bucket, key)
+	switch {
+	case err == nil:
+		info = &objInfo
+	case minio.ToErrorResponse(err).StatusCode != http.StatusNotFound:
+		return err
+	}
+	return cond.check(bucket, key, info)
+}
+
+// writeMeta writes metadata file using temporary file.
+func (f *FileSystem) writeMeta(name string, meta fsMeta) (err error) {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), fsTempPrefix+"*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return
+	}
+
+	return os.Rename(tmp.Name(), name)
+}
+
+// readMeta reads metadata file. Empty metadata returned if metadata file
+// does not exist or invalid.
+func (f *FileSystem) readMeta(name string) (meta fsMeta) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &meta)
+	return
+}
+
+// fileETag returns ETag of file data or empty string on error.
+func fileETag(name string) string {
+	file, err := os.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// fileMeta returns metadata of object file with file name and file stat. The
+// metadata of interrupted write describes other file, so the previous
+// metadata is used if it describes the file. Otherwise the metadata is kept
+// and its ETag is calculated from the file.
+func (f *FileSystem) fileMeta(name string, stat fs.FileInfo) (meta fsMeta) {
+	meta = f.readMeta(name + fsMetaSuffix)
+	switch {
+	case meta.ModTime.IsZero() || meta.matches(stat):
+	case meta.Prev != nil && meta.Prev.matches(stat):
+		meta = *meta.Prev
+	default:
+		meta.ETag = fileETag(name)
+	}
+	meta.Prev = nil
+	return
+}
+
+// objectInfo returns object info of key with file name and file stat.
+func (f *FileSystem) objectInfo(key, name string, stat fs.FileInfo) (
+	info minio.ObjectInfo) {
+
+	var size int64
+	if !isFolder(key) {
+		size = stat.Size()
+	}
+
+	var meta fsMeta
+	if isFolder(key) {
+		meta = f.readMeta(name + fsMetaSuffix)
+	} else {
+		meta = f.fileMeta(name, stat)
+	}
+
+	info = minio.ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ETag:         meta.ETag,
+		LastModified: stat.ModTime().UTC(),
+		ContentType:  meta.ContentType,
+		UserMetadata: meta.UserMetadata,
+		UserTags:     meta.UserTags,
+		StorageClass: meta.StorageClass,
+	}
+	if info.ContentType == "" {
+		info.ContentType = defaultContentType
+	}
+	return
+}
+
+// walk calls callback for each object of the bucket which key starts with
+// prefix.
+func (f *FileSystem) walk(bucket, prefix string,
+	callback func(info minio.ObjectInfo)) (err error) {
+
+	bucketDir, err := f.path(bucket, "")
+	if err != nil {
+		return
+	}
+
+	// Walk from the last directory of prefix
+	dir := bucketDir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		if dir, err = f.path(bucket, prefix[:i+1]); err != nil {
+			return nil
+		}
+	}
+
+	err = filepath.WalkDir(dir, func(name string, d fs.DirEntry,
+		err error) error {
+
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		// Skip metadata and temporary files
+		base := d.Name()
+		if name != dir && (strings.HasSuffix(base, fsMetaSuffix) ||
+			strings.HasPrefix(base, fsTempPrefix)) {
+			return nil
+		}
+
+		// Make key from file name
+		rel, err := filepath.Rel(bucketDir, name)
+		if err != nil || rel == "." {
+			return nil
+		}
+		key := filepath.ToSlash(rel)
+		if d.IsDir() {
+			key += "/"
+			if !strings.HasSuffix(name, string(filepath.Separator)) {
+				name += string(filepath.Separator)
+			}
+		}
+
+		// Skip keys which does not match the prefix
+		if !strings.HasPrefix(key, prefix) {
+			if d.IsDir() && !strings.HasPrefix(prefix, key) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		// Skip folders without metadata
+		f.wmut.RLock()
+		stat, err := os.Stat(name + f.folderMeta(key))
+		if err != nil || stat.IsDir() {
+			f.wmut.RUnlock()
+			return nil
+		}
+		info := f.objectInfo(key, name, stat)
+		f.wmut.RUnlock()
+
+		callback(info)
+		return nil
+	})
+
+	return
+}
+
+// path returns file name of key in the bucket.
+func (f *FileSystem) path(bucket, key string) (name string, err error) {
+	if err = s3utils.CheckValidBucketName(bucket); err != nil {
+		return
+	}
+
+	// Check key
+	parts := strings.Split(strings.TrimSuffix(key, "/"), "/")
+	for _, part := range parts {
+		if key == "" {
+			break
+		}
+		if part == "" || part == "." || part == ".." ||
+			strings.ContainsAny(part, "\\\x00") ||
+			strings.HasSuffix(part, fsMetaSuffix) ||
+			strings.HasPrefix(part, fsTempPrefix) {
+			err = minio.ErrorResponse{
+				StatusCode: http.StatusBadRequest,
+				Code:       "XMinioInvalidObjectName",
+				Message:    "Object name contains unsupported characters.",
+				BucketName: bucket,
+				Key:        key,
+			}
+			return
+		}
+	}
+
+	name = filepath.Join(append([]string{f.root, bucket}, parts...)...)
+	if isFolder(key) {
+		name += string(filepath.Separator)
+	}
+	return
+}
+
+// folderMeta returns name of folder metadata file if key is a folder. The
+// folder key file stat is a stat of this metadata file.
+func (f *FileSystem) folderMeta(key string) string {
+	if isFolder(key) {
+		return fsMetaSuffix
+	}
+	return ""
+}
+
+// error converts file system error to S3 error response.
+func (f *FileSystem) error(err error, bucket, key string) error {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTDIR) {
+		return errNoSuchKey(bucket, key)
+	}
+	return err
+}
+
+// fsReader is the FileSystem backend Object.
+type fsReader struct {
+	*os.File
+	info minio.ObjectInfo
+}
+
+// Stat returns object info.
+func (r *fsReader) Stat() (minio.ObjectInfo, error) { return r.info, nil }
+
+// isFolder returns true if key is a folder.
+func isFolder(key string) bool {
+	l := len(key)
+	return l > 0 && key[l-1] == '/'
+}
@@ -0,0 +1,149 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/teonet-go/teos3"
+)
+
+// setMeta saves key with data, content type and user metadata or fails test.
+func setMeta(t *testing.T, con *teos3.TeoS3, key, data, contentType,
+	value string) {
+
+	t.Helper()
+
+	opt := con.NewSetOptions()
+	opt.ContentType = contentType
+	opt.UserMetadata = map[string]string{"Value": value}
+	if err := con.Set(key, []byte(data), opt); err != nil {
+		t.Fatalf("set %s: %v", key, err)
+	}
+}
+
+// md5Hex returns hex encoded md5 sum of data.
+func md5Hex(data string) string {
+	sum := md5.Sum([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFileSystemSidecar(t *testing.T) {
+	root := t.TempDir()
+	con, err := teos3.ConnectDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(root, "teos3", "dir", "key")
+
+	// The metadata is saved in sidecar file and returned by GetInfo
+	setMeta(t, con, "dir/key", "data", "text/plain", "1")
+	if _, err := os.Stat(name + ".teos3meta"); err != nil {
+		t.Fatalf("sidecar file is not saved: %v", err)
+	}
+	info, err := con.GetInfo("dir/key")
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case info.ETag != md5Hex("data"):
+		t.Fatalf("got ETag %s, want %s", info.ETag, md5Hex("data"))
+	case info.ContentType != "text/plain":
+		t.Fatalf("got content type %s, want text/plain", info.ContentType)
+	case info.UserMetadata["Value"] != "1":
+		t.Fatalf("got metadata %v, want Value 1", info.UserMetadata)
+	}
+	if data := get(t, con, "dir/key"); string(data) != "data" {
+		t.Fatalf("got %q, want %q", data, "data")
+	}
+
+	// The sidecar and temporary files are not listed
+	err = os.WriteFile(filepath.Join(filepath.Dir(name), ".teos3tmp-1"),
+		[]byte("tmp"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, err := con.ListArErr("dir/")
+	switch {
+	case err != nil:
+		t.Fatal(err)
+	case len(keys) != 1 || keys[0] != "dir/key":
+		t.Fatalf("got keys %v, want [dir/key]", keys)
+	}
+
+	// The sidecar file is removed with object
+	if err := con.Del("dir/key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(name + ".teos3meta"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("sidecar file is not removed: %v", err)
+	}
+	if _, err := con.GetInfo("dir/key"); !errors.Is(err, teos3.ErrNotFound) {
+		t.Fatalf("got error %v, want %v", err, teos3.ErrNotFound)
+	}
+}
+
+func TestFileSystemInterruptedWrite(t *testing.T) {
+	tests := []struct {
+		name string
+		data string // object file data after write
+		meta string
+		ct   string
+	}{
+		// The sidecar is written but the object file is not renamed, the
+		// previous metadata describes the object file
+		{name: "interrupted", data: "old", meta: "old", ct: "text/old"},
+		// The object file is changed outside, the metadata is kept
+		{name: "changed", data: "other", meta: "new", ct: "text/new"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			con, err := teos3.ConnectDir(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := filepath.Join(root, "teos3", "key")
+
+			setMeta(t, con, "key", "old", "text/old", "old")
+			old, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			setMeta(t, con, "key", "new data", "text/new", "new")
+
+			// Replace object file
+			mtime := old.ModTime()
+			if err := os.WriteFile(name, []byte(tt.data), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chtimes(name, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := con.GetInfo("key")
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case info.ETag != md5Hex(tt.data):
+				t.Fatalf("got ETag %s, want %s", info.ETag, md5Hex(tt.data))
+			case info.ContentType != tt.ct:
+				t.Fatalf("got content type %s, want %s", info.ContentType,
+					tt.ct)
+			case info.UserMetadata["Value"] != tt.meta:
+				t.Fatalf("got metadata %v, want Value %s", info.UserMetadata,
+					tt.meta)
+			}
+			if data := get(t, con, "key"); string(data) != tt.data {
+				t.Fatalf("got %q, want %q", data, tt.data)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package iterators module.
+
+package teos3
+
+import (
+	"iter"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Keys returns iterator over map keys by prefix. The options parameter may be
+// omitted and than default ListOptions used, the Prefix parameter of the
+// ListObjectsOptions will be always overwritten with the prefix argument.
+// Listing error is yielded with empty key as the last iterator value. The
+// underlying objects listing stops when the loop breaks.
+//
+//	for key, err := range con.Keys("test/") {
+//		if err != nil {
+//			return err
+//		}
+//		fmt.Println(key)
+//	}
+func (m *TeoS3) Keys(prefix string, options ...*ListOptions) iter.Seq2[string,
+	error] {
+
+	// Get options from prefix and input options arguments
+	opt := m.getListOptions(prefix, options...)
+
+	return func(yield func(string, error) bool) {
+		err := m.listObjects(opt, func(obj minio.ObjectInfo) bool {
+			return yield(obj.Key, nil)
+		})
+		if err != nil {
+			yield("", err)
+		}
+	}
+}
+
+// All returns iterator over map keys and values by prefix. The options
+// parameter may be omitted and than default ListOptions used, the Prefix
+// parameter of the ListObjectsOptions will be always overwritten with the
+// prefix argument. Getting value error is yielded with MapData which
+// contains the key, listing error is yielded with empty MapData as the last
+// iterator value. The underlying objects listing stops when the loop breaks.
+func (m *TeoS3) All(prefix string, options ...*ListOptions) iter.Seq2[MapData,
+	error] {
+
+	// Get options from prefix and input options arguments
+	opt := m.getListOptions(prefix, options...)
+
+	return func(yield func(MapData, error) bool) {
+		err := m.listObjects(opt, func(obj minio.ObjectInfo) bool {
+			data, err := m.Get(obj.Key, &GetOptions{Context: opt.Context})
+			return yield(MapData{obj.Key, data}, err)
+		})
+		if err != nil {
+			yield(MapData{}, err)
+		}
+	}
+}
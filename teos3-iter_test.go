@@ -0,0 +1,101 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/teonet-go/teos3"
+)
+
+// stoppedList is backend which closes stopped channel when objects listing
+// context is canceled.
+type stoppedList struct {
+	teos3.Backend
+	stopped chan struct{}
+}
+
+func (b stoppedList) ListObjects(ctx context.Context, bucket string,
+	opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+
+	ch := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(ch)
+		objInfo := b.Backend.ListObjects(ctx, bucket, opts)
+		for info := range objInfo {
+			select {
+			case ch <- info:
+				continue
+			case <-ctx.Done():
+			}
+			break
+		}
+		if ctx.Err() != nil {
+			close(b.stopped)
+		}
+		for range objInfo {
+		}
+	}()
+	return ch
+}
+
+// The iterator loops break after three keys
+func TestIterBreak(t *testing.T) {
+	tests := []struct {
+		name string
+		iter func(t *testing.T, con *teos3.TeoS3) (keys []string)
+	}{
+		{"Keys", func(t *testing.T, con *teos3.TeoS3) (keys []string) {
+			for key, err := range con.Keys("") {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if keys = append(keys, key); len(keys) == 3 {
+					break
+				}
+			}
+			return
+		}},
+		{"All", func(t *testing.T, con *teos3.TeoS3) (keys []string) {
+			for mapData, err := range con.All("") {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(mapData.Value) != mapData.Key {
+					t.Fatalf("got %s value %q", mapData.Key, mapData.Value)
+				}
+				if keys = append(keys, mapData.Key); len(keys) == 3 {
+					break
+				}
+			}
+			return
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := stoppedList{teos3.NewMemory(), make(chan struct{})}
+			con := teos3.ConnectBackend(backend)
+			for i := range 10 {
+				set(t, con, fmt.Sprintf("key%d", i))
+			}
+
+			keys := tt.iter(t, con)
+			if len(keys) != 3 || keys[0] != "key0" || keys[2] != "key2" {
+				t.Fatalf("got keys %v, want [key0 key1 key2]", keys)
+			}
+
+			// The listing is stopped when the loop breaks
+			select {
+			case <-backend.stopped:
+			default:
+				t.Fatal("listing is not stopped after loop break")
+			}
+		})
+	}
+}
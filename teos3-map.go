@@ -0,0 +1,123 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package typed map module.
+
+package teos3
+
+import (
+	"iter"
+	"strings"
+)
+
+// Map is typed key-value map built on TeoS3 object. The Map values are
+// encoded with Codec and are saved to TeoS3 by keys with the Map prefix.
+//
+//	type User struct {
+//		Name string
+//	}
+//
+//	users := teos3.NewMap[User](con, "users/")
+//	err := users.Set("kirill", User{Name: "Kirill"})
+//	user, err := users.Get("kirill")
+type Map[V any] struct {
+	s3     *TeoS3
+	prefix string
+	codec  Codec
+}
+
+// MapEntry is typed map key and value used in Map All iterator.
+type MapEntry[V any] struct {
+	Key   string
+	Value V
+}
+
+// NewMap creates new typed Map on TeoS3 object with keys prefix. The codec
+// parameter may be omitted and than JSONCodec used.
+func NewMap[V any](s3 *TeoS3, prefix string, codecs ...Codec) *Map[V] {
+	codec := JSONCodec
+	if len(codecs) > 0 && codecs[0] != nil {
+		codec = codecs[0]
+	}
+	return &Map[V]{s3, prefix, codec}
+}
+
+// Prefix returns map keys prefix.
+func (m *Map[V]) Prefix() string { return m.prefix }
+
+// Set encodes and sets value to map by key.
+func (m *Map[V]) Set(key string, value V, options ...*SetOptions) error {
+	data, err := m.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return m.s3.Set(m.prefix+key, data, options...)
+}
+
+// Get gets and decodes value from map by key.
+func (m *Map[V]) Get(key string, options ...*GetOptions) (value V, err error) {
+	data, err := m.s3.Get(m.prefix+key, options...)
+	if err != nil {
+		return
+	}
+	err = m.codec.Unmarshal(data, &value)
+	return
+}
+
+// Del removes key from map.
+func (m *Map[V]) Del(key string, options ...*DelOptions) error {
+	return m.s3.Del(m.prefix+key, options...)
+}
+
+// List gets array of map keys by prefix and listing error. Returned keys are
+// relative to the map prefix.
+func (m *Map[V]) List(prefix string, options ...*ListOptions) (
+	list []string, err error) {
+
+	for key, e := range m.Keys(prefix, options...) {
+		if e != nil {
+			err = e
+			break
+		}
+		list = append(list, key)
+	}
+	return
+}
+
+// Keys returns iterator over map keys by prefix. Keys are relative to the map
+// prefix. Listing error is yielded with empty key as the last iterator value.
+func (m *Map[V]) Keys(prefix string, options ...*ListOptions) iter.Seq2[string,
+	error] {
+
+	return func(yield func(string, error) bool) {
+		for key, err := range m.s3.Keys(m.prefix+prefix, options...) {
+			if !yield(strings.TrimPrefix(key, m.prefix), err) {
+				return
+			}
+		}
+	}
+}
+
+// All returns iterator over map keys and decoded values by prefix. Keys are
+// relative to the map prefix. Getting or decoding value error is yielded with
+// MapEntry which contains the key, listing error is yielded with empty
+// MapEntry as the last iterator value.
+func (m *Map[V]) All(prefix string, options ...*ListOptions) iter.Seq2[MapEntry[V],
+	error] {
+
+	return func(yield func(MapEntry[V], error) bool) {
+		for data, err := range m.s3.All(m.prefix+prefix, options...) {
+			var entry MapEntry[V]
+			if data.Key != "" {
+				entry.Key = strings.TrimPrefix(data.Key, m.prefix)
+			}
+			if err == nil {
+				err = m.codec.Unmarshal(data.Value, &entry.Value)
+			}
+			if !yield(entry, err) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/teonet-go/teos3"
+)
+
+func TestMap(t *testing.T) {
+	codecs := []struct {
+		name  string
+		codec teos3.Codec
+	}{
+		{"json", teos3.JSONCodec},
+		{"gob", teos3.GobCodec},
+	}
+	users := map[string]user{"a": {"Anna", 20}, "b": {"Boris", 30}}
+
+	for backend, con := range connections(t, nil) {
+		for _, c := range codecs {
+			t.Run(backend+"/"+c.name, func(t *testing.T) {
+				m := teos3.NewMap[user](con, c.name+"/users/", c.codec)
+				for key, u := range users {
+					if err := m.Set(key, u); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// Get and list decoded values by keys relative to prefix
+				u, err := m.Get("a")
+				switch {
+				case err != nil:
+					t.Fatal(err)
+				case u != users["a"]:
+					t.Fatalf("got %v, want %v", u, users["a"])
+				}
+				keys, err := m.List("")
+				switch {
+				case err != nil:
+					t.Fatal(err)
+				case !slices.Equal(keys, []string{"a", "b"}):
+					t.Fatalf("got keys %v, want [a b]", keys)
+				}
+				var n int
+				for entry, err := range m.All("") {
+					if err != nil {
+						t.Fatal(err)
+					}
+					if entry.Value != users[entry.Key] {
+						t.Fatalf("got %s value %v, want %v", entry.Key,
+							entry.Value, users[entry.Key])
+					}
+					n++
+				}
+				if n != len(users) {
+					t.Fatalf("got %d entries, want %d", n, len(users))
+				}
+
+				// Decoding error is yielded with the key
+				if err := con.Set(m.Prefix()+"c", []byte("bad")); err != nil {
+					t.Fatal(err)
+				}
+				for entry, err := range m.All("c") {
+					if err == nil || entry.Key != "c" {
+						t.Fatalf("got entry %v error %v, want c error",
+							entry, err)
+					}
+				}
+
+				// Removed key is not found
+				if err := m.Del("a"); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := m.Get("a"); !errors.Is(err, teos3.ErrNotFound) {
+					t.Fatalf("got error %v, want %v", err, teos3.ErrNotFound)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,580 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package in-memory backend module.
+
+package teos3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// Memory is in-memory Backend which behaves like S3 storage. It may be used
+// in unit tests or in deployments without S3. Buckets are created by
+// MakeBucket or on first write.
+type Memory struct {
+	mut     sync.RWMutex
+	buckets map[string]map[string]*memoryObject
+	created map[string]time.Time
+}
+
+// memoryObject is the Memory backend object.
+type memoryObject struct {
+	data []byte
+	info minio.ObjectInfo
+}
+
+// NewMemory creates new in-memory Backend.
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]map[string]*memoryObject),
+		created: make(map[string]time.Time),
+	}
+}
+
+// ConnectMemory creates new TeoS3 object which uses new in-memory backend and
+// bucket (if omitted then default 'teos3' buckets name used).
+func ConnectMemory(buckets ...string) *TeoS3 {
+	return ConnectBackend(NewMemory(), buckets...)
+}
+
+// PutObject saves object from reader to the bucket by key.
+func (m *Memory) PutObject(ctx context.Context, bucket, key string,
+	reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (
+	info minio.UploadInfo, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	// Read object data
+	data, err := readObject(reader, objectSize)
+	if err != nil {
+		return
+	}
+
+	// Create object info
+	objInfo := minio.ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		ETag:         etag(data),
+		LastModified: time.Now().UTC(),
+		ContentType:  opts.ContentType,
+		UserMetadata: userMetadata(opts.UserMetadata),
+		UserTags:     opts.UserTags,
+		StorageClass: opts.StorageClass,
+	}
+	if objInfo.ContentType == "" {
+		objInfo.ContentType = defaultContentType
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	err = putPrecondition(opts).check(bucket, key, m.info(bucket, key))
+	if err != nil {
+		return
+	}
+	m.bucketObjects(bucket)[key] = &memoryObject{data, objInfo}
+
+	info = uploadInfo(bucket, objInfo)
+	return
+}
+
+// GetObject returns object from the bucket by key.
+func (m *Memory) GetObject(ctx context.Context, bucket, key string,
+	opts minio.GetObjectOptions) (Object, error) {
+
+	obj, err := m.object(ctx, bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	return &memoryReader{bytes.NewReader(obj.data), obj.info}, nil
+}
+
+// StatObject returns metadata of object from the bucket by key.
+func (m *Memory) StatObject(ctx context.Context, bucket, key string,
+	opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+
+	obj, err := m.object(ctx, bucket, key)
+	if err != nil {
+		return minio.ObjectInfo{}, err
+	}
+	return obj.info, nil
+}
+
+// RemoveObject removes object from the bucket by key. Removing of not
+// existing object is not an error.
+func (m *Memory) RemoveObject(ctx context.Context, bucket, key string,
+	opts minio.RemoveObjectOptions) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	delete(m.buckets[bucket], key)
+
+	return nil
+}
+
+// RemoveObjects removes objects received from objectsCh channel from the
+// bucket.
+func (m *Memory) RemoveObjects(ctx context.Context, bucket string,
+	objectsCh <-chan minio.ObjectInfo,
+	opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+	return removeObjects(ctx, m, bucket, objectsCh, opts)
+}
+
+// ListObjects lists objects of the bucket. Objects are listed in key order.
+// If opts.Recursive is false then keys with '/' after the prefix are grouped
+// to folder keys.
+func (m *Memory) ListObjects(ctx context.Context, bucket string,
+	opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+
+	// Get objects info snapshot
+	m.mut.RLock()
+	var infos []minio.ObjectInfo
+	for key, obj := range m.buckets[bucket] {
+		if strings.HasPrefix(key, opts.Prefix) {
+			infos = append(infos, obj.info)
+		}
+	}
+	m.mut.RUnlock()
+
+	return listObjects(ctx, infos, opts)
+}
+
+// CopyObject copies source object to destination object.
+func (m *Memory) CopyObject(ctx context.Context, dst minio.CopyDestOptions,
+	src minio.CopySrcOptions) (info minio.UploadInfo, err error) {
+	return m.CopyObjectIf(ctx, dst, src, "", "")
+}
+
+// CopyObjectIf copies source object to destination object if destination
+// object preconditions hold.
+func (m *Memory) CopyObjectIf(ctx context.Context, dst minio.CopyDestOptions,
+	src minio.CopySrcOptions, ifMatch, ifNoneMatch string) (
+	info minio.UploadInfo, err error) {
+
+	obj, err := m.object(ctx, src.Bucket, src.Object)
+	if err != nil {
+		return
+	}
+	if err = checkCopySource(src, obj.info); err != nil {
+		return
+	}
+
+	objInfo := copyObjectInfo(obj.info, dst)
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	err = precondition{ifMatch, ifNoneMatch}.check(dst.Bucket, dst.Object,
+		m.info(dst.Bucket, dst.Object))
+	if err != nil {
+		return
+	}
+	m.bucketObjects(dst.Bucket)[dst.Object] = &memoryObject{obj.data, objInfo}
+
+	info = uploadInfo(dst.Bucket, objInfo)
+	return
+}
+
+// BucketExists returns true if the bucket exists.
+func (m *Memory) BucketExists(ctx context.Context, bucket string) (bool,
+	error) {
+
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+	_, ok := m.buckets[bucket]
+
+	return ok, nil
+}
+
+// MakeBucket creates new bucket.
+func (m *Memory) MakeBucket(ctx context.Context, bucket string,
+	opts minio.MakeBucketOptions) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s3utils.CheckValidBucketNameStrict(bucket); err != nil {
+		return err
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	if _, ok := m.buckets[bucket]; ok {
+		return errBucketAlreadyOwnedByYou(bucket)
+	}
+	m.bucketObjects(bucket)
+
+	return nil
+}
+
+// RemoveBucket removes empty bucket.
+func (m *Memory) RemoveBucket(ctx context.Context, bucket string) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	m.mut.Lock()
+	defer m.mut.Unlock()
+	objects, ok := m.buckets[bucket]
+	switch {
+	case !ok:
+		return errNoSuchBucket(bucket)
+	case len(objects) > 0:
+		return errBucketNotEmpty(bucket)
+	}
+	delete(m.buckets, bucket)
+	delete(m.created, bucket)
+
+	return nil
+}
+
+// ListBuckets returns list of all buckets sorted by name.
+func (m *Memory) ListBuckets(ctx context.Context) (buckets []minio.BucketInfo,
+	err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	m.mut.RLock()
+	for bucket := range m.buckets {
+		buckets = append(buckets, minio.BucketInfo{
+			Name:         bucket,
+			CreationDate: m.created[bucket],
+		})
+	}
+	m.mut.RUnlock()
+
+	sortBuckets(buckets)
+	return
+}
+
+// object returns memory object by bucket and key or NoSuchKey error.
+func (m *Memory) object(ctx context.Context, bucket, key string) (
+	obj *memoryObject, err error) {
+
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	m.mut.RLock()
+	defer m.mut.RUnlock()
+
+	obj, ok := m.buckets[bucket][key]
+	if !ok {
+		err = errNoSuchKey(bucket, key)
+	}
+	return
+}
+
+// info returns object info by bucket and key or nil if object does not
+// exist. It should be called under lock.
+func (m *Memory) info(bucket, key string) *minio.ObjectInfo {
+	obj, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil
+	}
+	return &obj.info
+}
+
+// bucketObjects returns objects map of bucket and creates it if it does not
+// exist. It should be called under write lock.
+func (m *Memory) bucketObjects(bucket string) map[string]*memoryObject {
+	objects, ok := m.buckets[bucket]
+	if !ok {
+		objects = make(map[string]*memoryObject)
+		m.buckets[bucket] = objects
+		m.created[bucket] = time.Now().UTC()
+	}
+	return objects
+}
+
+// memoryReader is the Memory backend Object.
+type memoryReader struct {
+	*bytes.Reader
+	info minio.ObjectInfo
+}
+
+// Stat returns object info.
+func (r *memoryReader) Stat() (minio.ObjectInfo, error) { return r.info, nil }
+
+// Close closes object.
+func (r *memoryReader) Close() error { return nil }
+
+// defaultContentType is content type of objects saved without content type.
+const defaultContentType = "application/octet-stream"
+
+// readObject reads object data from reader. If objectSize is not negative
+// than exactly objectSize bytes should be read.
+func readObject(reader io.Reader, objectSize int64) (data []byte, err error) {
+	if objectSize < 0 {
+		return io.ReadAll(reader)
+	}
+
+	data = make([]byte, objectSize)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		err = fmt.Errorf("read object: %w", err)
+	}
+	return
+}
+
+// etag returns S3 ETag (md5 hex string) of data.
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// userMetadata returns copy of user metadata with canonical keys without
+// 'X-Amz-Meta-' prefix, the same as minio returns in ObjectInfo.
+func userMetadata(metadata map[string]string) (m minio.StringMap) {
+	if len(metadata) == 0 {
+		return
+	}
+	m = make(minio.StringMap, len(metadata))
+	for k, v := range metadata {
+		k = http.CanonicalHeaderKey(k)
+		m[strings.TrimPrefix(k, "X-Amz-Meta-")] = v
+	}
+	return
+}
+
+// checkCopySource returns PreconditionFailed error if source object with info
+// does not match copy source preconditions.
+func checkCopySource(src minio.CopySrcOptions, info minio.ObjectInfo) error {
+	etag := func(etag string) string { return strings.Trim(etag, `"`) }
+	modified := info.LastModified.Truncate(time.Second)
+	if src.MatchETag != "" && etag(src.MatchETag) != info.ETag ||
+		src.NoMatchETag != "" && etag(src.NoMatchETag) == info.ETag ||
+		!src.MatchModifiedSince.IsZero() &&
+			!modified.After(src.MatchModifiedSince) ||
+		!src.MatchUnmodifiedSince.IsZero() &&
+			modified.After(src.MatchUnmodifiedSince) {
+		return errPreconditionFailed(src.Bucket, src.Object)
+	}
+	return nil
+}
+
+// copyObjectInfo returns info of the destination object copied from source
+// object with info.
+func copyObjectInfo(info minio.ObjectInfo,
+	dst minio.CopyDestOptions) minio.ObjectInfo {
+
+	info.Key = dst.Object
+	info.LastModified = time.Now().UTC()
+	if dst.ReplaceMetadata {
+		metadata := make(map[string]string, len(dst.UserMetadata))
+		for k, v := range dst.UserMetadata {
+			switch http.CanonicalHeaderKey(k) {
+			case "Content-Type":
+				info.ContentType = v
+			case "X-Amz-Storage-Class":
+				info.StorageClass = v
+			default:
+				metadata[k] = v
+			}
+		}
+		info.UserMetadata = userMetadata(metadata)
+	}
+	if dst.ContentType != "" {
+		info.ContentType = dst.ContentType
+	}
+	if dst.ReplaceTags {
+		info.UserTags = dst.UserTags
+	}
+	return info
+}
+
+// uploadInfo returns UploadInfo of object with info.
+func uploadInfo(bucket string, info minio.ObjectInfo) minio.UploadInfo {
+	return minio.UploadInfo{
+		Bucket:       bucket,
+		Key:          info.Key,
+		ETag:         info.ETag,
+		Size:         info.Size,
+		LastModified: info.LastModified,
+	}
+}
+
+// errNoSuchKey returns S3 error response of not existing key.
+func errNoSuchKey(bucket, key string) error {
+	return minio.ErrorResponse{
+		StatusCode: http.StatusNotFound,
+		Code:       "NoSuchKey",
+		Message:    "The specified key does not exist.",
+		BucketName: bucket,
+		Key:        key,
+	}
+}
+
+// precondition contains destination object preconditions of put or copy
+// requests.
+type precondition struct {
+	ifMatch     string
+	ifNoneMatch string
+}
+
+// putPrecondition returns preconditions of put object options.
+func putPrecondition(opts minio.PutObjectOptions) precondition {
+	header := opts.Header()
+	return precondition{header.Get("If-Match"), header.Get("If-None-Match")}
+}
+
+// check returns PreconditionFailed error if object with info (nil if object
+// does not exist) does not match the preconditions.
+func (p precondition) check(bucket, key string, info *minio.ObjectInfo) error {
+	match := func(etag string) bool {
+		return info != nil &&
+			(etag == "*" || strings.Trim(etag, `"`) == info.ETag)
+	}
+	if p.ifMatch != "" && !match(p.ifMatch) ||
+		p.ifNoneMatch != "" && match(p.ifNoneMatch) {
+		return errPreconditionFailed(bucket, key)
+	}
+	return nil
+}
+
+// errPreconditionFailed returns S3 error response of failed precondition.
+func errPreconditionFailed(bucket, key string) error {
+	return minio.ErrorResponse{
+		StatusCode: http.StatusPreconditionFailed,
+		Code:       "PreconditionFailed",
+		Message:    "At least one of the pre-conditions you specified did not hold",
+		BucketName: bucket,
+		Key:        key,
+	}
+}
+
+// errNoSuchBucket returns S3 error response of not existing bucket.
+func errNoSuchBucket(bucket string) error {
+	return minio.ErrorResponse{
+		StatusCode: http.StatusNotFound,
+		Code:       "NoSuchBucket",
+		Message:    "The specified bucket does not exist.",
+		BucketName: bucket,
+	}
+}
+
+// errBucketNotEmpty returns S3 error response of removing not empty bucket.
+func errBucketNotEmpty(bucket string) error {
+	return minio.ErrorResponse{
+		StatusCode: http.StatusConflict,
+		Code:       "BucketNotEmpty",
+		Message:    "The bucket you tried to delete is not empty.",
+		BucketName: bucket,
+	}
+}
+
+// errBucketAlreadyOwnedByYou returns S3 error response of creating existing
+// bucket.
+func errBucketAlreadyOwnedByYou(bucket string) error {
+	return minio.ErrorResponse{
+		StatusCode: http.StatusConflict,
+		Code:       "BucketAlreadyOwnedByYou",
+		Message: "Your previous request to create the named bucket " +
+			"succeeded and you already own it.",
+		BucketName: bucket,
+	}
+}
+
+// sortBuckets sorts buckets by name.
+func sortBuckets(buckets []minio.BucketInfo) {
+	sort.Slice(buckets, func(i, j int) bool {
+		return buckets[i].Name < buckets[j].Name
+	})
+}
+
+// removeObjects removes objects received from objectsCh channel one by one
+// with backend RemoveObject and sends removing errors to output channel. The
+// output channel should be read to the end.
+func removeObjects(ctx context.Context, backend Backend, bucket string,
+	objectsCh <-chan minio.ObjectInfo,
+	opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+
+	errs := make(chan minio.RemoveObjectError, 1)
+	go func() {
+		defer close(errs)
+		for obj := range objectsCh {
+			err := backend.RemoveObject(ctx, bucket, obj.Key,
+				minio.RemoveObjectOptions{
+					GovernanceBypass: opts.GovernanceBypass,
+					VersionID:        obj.VersionID,
+				})
+			if err != nil {
+				errs <- minio.RemoveObjectError{
+					ObjectName: obj.Key,
+					VersionID:  obj.VersionID,
+					Err:        err,
+				}
+			}
+		}
+	}()
+
+	return errs
+}
+
+// listObjects sends sorted objects infos which match opts to output channel.
+// If opts.Recursive is false then keys with '/' after the prefix are grouped
+// to folder keys the same way as S3 does.
+func listObjects(ctx context.Context, infos []minio.ObjectInfo,
+	opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+
+	objInfo := make(chan minio.ObjectInfo, 1)
+	go func() {
+		defer close(objInfo)
+
+		var folder string
+		for _, info := range infos {
+			if !strings.HasPrefix(info.Key, opts.Prefix) ||
+				opts.StartAfter != "" && info.Key <= opts.StartAfter {
+				continue
+			}
+
+			// Group keys to folder
+			if !opts.Recursive {
+				rest := info.Key[len(opts.Prefix):]
+				if i := strings.Index(rest, "/"); i >= 0 {
+					name := opts.Prefix + rest[:i+1]
+					if name == folder {
+						continue
+					}
+					folder = name
+					info = minio.ObjectInfo{Key: name}
+				}
+			}
+
+			select {
+			case objInfo <- info:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return objInfo
+}
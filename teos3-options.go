@@ -8,6 +8,11 @@ package teos3
 
 import (
 	"context"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 )
@@ -17,6 +22,11 @@ import (
 type SetOptions struct {
 	context.Context
 	SetObjectOptions
+
+	// StoreChecksum is the algorithm of object checksum calculated while
+	// object is uploaded and stored in object user metadata by
+	// ChecksumMetaKey. The checksum is not calculated if it is empty.
+	StoreChecksum ChecksumAlgorithm
 }
 type SetObjectOptions minio.PutObjectOptions
 
@@ -28,8 +38,8 @@ func (m *TeoS3) getSetOptions(options ...*SetOptions) (
 	opt *SetOptions) {
 
 	opt = &SetOptions{}
-	if len(options) > 0 {
-		opt = options[0]
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
 	}
 
 	if opt.Context == nil {
@@ -55,8 +65,8 @@ func (m *TeoS3) getGetOptions(options ...*GetOptions) (
 	opt *GetOptions) {
 
 	opt = &GetOptions{}
-	if len(options) > 0 {
-		opt = options[0]
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
 	}
 
 	if opt.Context == nil {
@@ -82,8 +92,8 @@ func (m *TeoS3) getGetInfoOptions(options ...*GetInfoOptions) (
 	opt *GetInfoOptions) {
 
 	opt = &GetInfoOptions{}
-	if len(options) > 0 {
-		opt = options[0]
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
 	}
 
 	if opt.Context == nil {
@@ -98,6 +108,13 @@ func (m *TeoS3) getGetInfoOptions(options ...*GetInfoOptions) (
 type DelOptions struct {
 	context.Context
 	DelObjectOptions
+
+	// Workers is the number of concurrent RemoveObjects requests in folder
+	// Del. The DefaultWorkers used if Workers is not set.
+	Workers int
+
+	// Summary is set to the Del result summary if not nil.
+	Summary *Summary
 }
 type DelObjectOptions minio.RemoveObjectOptions
 
@@ -109,13 +126,16 @@ func (m *TeoS3) getDelOptions(options ...*DelOptions) (
 	opt *DelOptions) {
 
 	opt = &DelOptions{}
-	if len(options) > 0 {
-		opt = options[0]
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
 	}
 
 	if opt.Context == nil {
 		opt.Context = m.context
 	}
+	if opt.Workers <= 0 {
+		opt.Workers = DefaultWorkers
+	}
 
 	return
 }
@@ -124,9 +144,20 @@ func (m *TeoS3) getDelOptions(options ...*DelOptions) (
 type ListOptions struct {
 	context.Context
 	ListObjectsOptions
+
+	// Workers is the number of concurrent get value requests in ListBody
+	// functions. The DefaultListWorkers used if Workers is not set.
+	Workers int
+
+	// Ordered sets ListBody functions to deliver results in keys order.
+	Ordered bool
 }
 type ListObjectsOptions minio.ListObjectsOptions
 
+// DefaultListWorkers is default number of concurrent get value requests in
+// ListBody functions.
+const DefaultListWorkers = 16
+
 // NewListOptions creates a new ListOptions object
 func (m *TeoS3) NewListOptions() *ListOptions { return &ListOptions{} }
 
@@ -142,25 +173,369 @@ func (l *ListOptions) SetStartAfter(startAfter string) *ListOptions {
 	return l
 }
 
+// SetWorkers sets number of concurrent get value requests in ListBody
+// functions
+func (l *ListOptions) SetWorkers(workers int) *ListOptions {
+	l.Workers = workers
+	return l
+}
+
+// SetOrdered sets ListBody functions to deliver results in keys order
+func (l *ListOptions) SetOrdered(ordered bool) *ListOptions {
+	l.Ordered = ordered
+	return l
+}
+
 // getListOptions returns ListObjectsOptions created from input prefix and
 // options arguments.
 func (m *TeoS3) getListOptions(prefix string, options ...*ListOptions) (
 	opt *ListOptions) {
 
 	opt = &ListOptions{}
-	if len(options) > 0 {
-		opt = options[0]
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
 	}
 
 	if opt.Context == nil {
 		opt.Context = m.context
 	}
+	if opt.Workers <= 0 {
+		opt.Workers = DefaultListWorkers
+	}
 	opt.Prefix = prefix
 
 	return
 }
 
-// CopyOptions contains context.Context for Copy or Move requests.
+// CopyOptions contains context.Context and options for Copy or Move requests.
 type CopyOptions struct {
 	context.Context
+
+	// Overwrite is the mode used if destination object exists. It is applied
+	// to each object of copied folder.
+	Overwrite Overwrite
+
+	// Workers is the number of concurrent copy requests in folder Copy and
+	// Move. The DefaultWorkers used if Workers is not set.
+	Workers int
+
+	// Summary is set to the Copy or Move result summary if not nil.
+	Summary *Summary
+
+	// Metadata is the destination object user metadata mode. The source
+	// object user metadata is copied by default.
+	Metadata MetadataDirective
+
+	// UserMetadata is the user metadata used in MetadataReplace and
+	// MetadataMerge modes.
+	UserMetadata map[string]string
+
+	// ContentType and StorageClass replace source object content type and
+	// storage class if not empty.
+	ContentType  string
+	StorageClass string
+
+	// ReplaceTags sets UserTags to destination object instead of source
+	// object tags.
+	ReplaceTags bool
+	UserTags    map[string]string
+
+	// MatchETag, NoMatchETag, MatchModifiedSince and MatchUnmodifiedSince
+	// are source object preconditions. The ErrPreconditionFailed is returned
+	// if source object does not match them.
+	MatchETag            string
+	NoMatchETag          string
+	MatchModifiedSince   time.Time
+	MatchUnmodifiedSince time.Time
+}
+
+// MetadataDirective is the Copy and Move mode of destination object user
+// metadata. The object may be copied onto itself with OverwriteAlways mode
+// to change its metadata, content type, storage class or tags.
+type MetadataDirective int
+
+// Metadata directives
+const (
+	// MetadataCopy copies source object user metadata. It is the default
+	// directive.
+	MetadataCopy MetadataDirective = iota
+
+	// MetadataReplace replaces source object user metadata with CopyOptions
+	// UserMetadata.
+	MetadataReplace
+
+	// MetadataMerge adds CopyOptions UserMetadata to source object user
+	// metadata, the existing keys are replaced.
+	MetadataMerge
+)
+
+// DefaultWorkers is default number of concurrent requests in folder Copy,
+// Move and Del and concurrent file copies in recursive CopyWith.
+const DefaultWorkers = 16
+
+// Overwrite is the Copy and Move mode used if destination object exists.
+type Overwrite int
+
+// Overwrite modes
+const (
+	// OverwriteFail returns ErrDestinationObjectAlreadyExists if destination
+	// object exists. It is the default mode.
+	OverwriteFail Overwrite = iota
+
+	// OverwriteAlways replaces existing destination object.
+	OverwriteAlways
+
+	// OverwriteSkip skips source object if destination object exists.
+	OverwriteSkip
+
+	// OverwriteIfNewer replaces existing destination object if source object
+	// was modified after destination object.
+	OverwriteIfNewer
+
+	// OverwriteIfDifferent replaces existing destination object if source and
+	// destination objects size or ETag differ. The multipart upload ETag
+	// depends on part size, so if one of objects was uploaded by parts their
+	// checksums stored in user metadata by ChecksumMetaKey are compared, and
+	// objects without equal checksums are different.
+	OverwriteIfDifferent
+)
+
+// getCopyOptions returns CopyOptions created from input options arguments.
+func (m *TeoS3) getCopyOptions(options ...*CopyOptions) (
+	opt *CopyOptions) {
+
+	opt = &CopyOptions{}
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
+	}
+
+	if opt.Context == nil {
+		opt.Context = m.context
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = DefaultWorkers
+	}
+
+	return
+}
+
+// setObjectOptions returns opts with If-Match and If-None-Match preconditions.
+func (p precondition) setObjectOptions(opts SetObjectOptions) SetObjectOptions {
+	putOpts := (*minio.PutObjectOptions)(&opts)
+	if p.ifMatch != "" {
+		putOpts.SetMatchETag(p.ifMatch)
+	}
+	if p.ifNoneMatch != "" {
+		putOpts.SetMatchETagExcept(p.ifNoneMatch)
+	}
+	return opts
+}
+
+// replaceMetadata returns true if copy options change source object user
+// metadata, content type or storage class.
+func (opt *CopyOptions) replaceMetadata() bool {
+	return opt.Metadata != MetadataCopy || opt.ContentType != "" ||
+		opt.StorageClass != ""
+}
+
+// objectOptions returns destination object options created from source
+// object info and copy options.
+func (opt *CopyOptions) objectOptions(info minio.ObjectInfo) (
+	opts SetObjectOptions) {
+
+	opts = SetObjectOptions{
+		ContentType:  info.ContentType,
+		UserMetadata: info.UserMetadata,
+		UserTags:     info.UserTags,
+		StorageClass: info.StorageClass,
+	}
+	if opts.StorageClass == "" {
+		opts.StorageClass = info.Metadata.Get("X-Amz-Storage-Class")
+	}
+
+	// Set user metadata
+	switch opt.Metadata {
+	case MetadataReplace:
+		opts.UserMetadata = opt.UserMetadata
+	case MetadataMerge:
+		opts.UserMetadata = make(map[string]string,
+			len(info.UserMetadata)+len(opt.UserMetadata))
+		for k, v := range info.UserMetadata {
+			opts.UserMetadata[http.CanonicalHeaderKey(k)] = v
+		}
+		for k, v := range opt.UserMetadata {
+			k = strings.TrimPrefix(http.CanonicalHeaderKey(k), "X-Amz-Meta-")
+			opts.UserMetadata[k] = v
+		}
+	}
+
+	if opt.ContentType != "" {
+		opts.ContentType = opt.ContentType
+	}
+	if opt.StorageClass != "" {
+		opts.StorageClass = opt.StorageClass
+	}
+	if opt.ReplaceTags {
+		opts.UserTags = opt.UserTags
+	}
+
+	return
+}
+
+// sourcePreconditions returns true if copy options contain source object
+// preconditions.
+func (opt *CopyOptions) sourcePreconditions() bool {
+	return opt.MatchETag != "" || opt.NoMatchETag != "" ||
+		!opt.MatchModifiedSince.IsZero() || !opt.MatchUnmodifiedSince.IsZero()
+}
+
+// copySource returns copy source options of source object with copy options
+// source preconditions.
+func (opt *CopyOptions) copySource(bucket, object string) minio.CopySrcOptions {
+	return minio.CopySrcOptions{
+		Bucket:               bucket,
+		Object:               object,
+		MatchETag:            opt.MatchETag,
+		NoMatchETag:          opt.NoMatchETag,
+		MatchModifiedSince:   opt.MatchModifiedSince,
+		MatchUnmodifiedSince: opt.MatchUnmodifiedSince,
+	}
+}
+
+// CopyWithOptions contains context.Context and options for CopyWith requests.
+// The canceled context stops copy and aborts incomplete multipart upload of
+// target S3 object.
+type CopyWithOptions struct {
+	context.Context
+
+	// Progress is called with copy progress not more often than
+	// ProgressInterval and when copy finished, if not nil.
+	Progress ProgressFunc
+
+	// ProgressInterval is the minimal interval between Progress calls. The
+	// DefaultProgressInterval used if ProgressInterval is not set.
+	ProgressInterval time.Duration
+
+	// Recursive copies local directory to S3 folder or S3 folder to local
+	// directory.
+	Recursive bool
+
+	// Workers is the number of concurrent file copies in recursive copy. The
+	// DefaultWorkers used if Workers is not set.
+	Workers int
+
+	// Summary is set to the recursive copy result summary if not nil.
+	Summary *Summary
+
+	// Stdin and Stdout are used as '-' source and target. The os.Stdin and
+	// os.Stdout used if they are not set.
+	Stdin  io.Reader
+	Stdout io.Writer
+
+	// Checksum is the algorithm of checksum stored in metadata of uploaded
+	// s3 objects, the checksum is not stored if it is empty. The checksum
+	// stored in s3 object metadata is always verified when object is
+	// downloaded.
+	Checksum ChecksumAlgorithm
+}
+
+// getCopyWithOptions returns CopyWithOptions created from input options
+// arguments.
+func (m *TeoS3) getCopyWithOptions(options ...*CopyWithOptions) (
+	opt *CopyWithOptions) {
+
+	opt = &CopyWithOptions{}
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
+	}
+
+	if opt.Context == nil {
+		opt.Context = m.context
+	}
+	if opt.ProgressInterval <= 0 {
+		opt.ProgressInterval = DefaultProgressInterval
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = DefaultWorkers
+	}
+	if opt.Stdin == nil {
+		opt.Stdin = os.Stdin
+	}
+	if opt.Stdout == nil {
+		opt.Stdout = os.Stdout
+	}
+
+	return
+}
+
+// SyncOptions contains context.Context and options for Sync requests.
+type SyncOptions struct {
+	context.Context
+
+	// Delete removes target files which do not exist in source. In TwoWay
+	// mode it removes files deleted on other side since last sync.
+	Delete bool
+
+	// DryRun reports actions by Action function without executing them.
+	DryRun bool
+
+	// TwoWay synchronizes changes of both sides. The changes are detected by
+	// state of last sync saved to SyncStateFile of local directory. The file
+	// changed on both sides is reported as conflict and is not copied.
+	TwoWay bool
+
+	// Checksum compares MD5 of files with the same size and different
+	// modification time, the files with equal MD5 are not copied and get
+	// the same modification time to skip MD5 in next sync.
+	Checksum bool
+
+	// Include and Exclude are glob patterns of path.Match syntax. If Include
+	// is not empty only files which match one of Include patterns are
+	// synchronized, files which match one of Exclude patterns are skipped.
+	// The pattern without '/' matches any element of file name, the pattern
+	// with '/' matches file name or its parent folder.
+	Include []string
+	Exclude []string
+
+	// Workers is the number of concurrent file copies and removes. The
+	// DefaultWorkers used if Workers is not set.
+	Workers int
+
+	// Action is called for each synchronization action before it is
+	// executed, if not nil.
+	Action func(a SyncAction)
+
+	// Progress is called with copy progress not more often than
+	// ProgressInterval and when sync finished, if not nil.
+	Progress ProgressFunc
+
+	// ProgressInterval is the minimal interval between Progress calls. The
+	// DefaultProgressInterval used if ProgressInterval is not set.
+	ProgressInterval time.Duration
+
+	// Summary is set to the Sync result summary if not nil. The Objects and
+	// Bytes contain copied and removed files, the Skipped contains files
+	// which are already in sync.
+	Summary *Summary
+}
+
+// getSyncOptions returns SyncOptions created from input options arguments.
+func (m *TeoS3) getSyncOptions(options ...*SyncOptions) (opt *SyncOptions) {
+
+	opt = &SyncOptions{}
+	if len(options) > 0 && options[0] != nil {
+		*opt = *options[0]
+	}
+
+	if opt.Context == nil {
+		opt.Context = m.context
+	}
+	if opt.Workers <= 0 {
+		opt.Workers = DefaultWorkers
+	}
+	if opt.ProgressInterval <= 0 {
+		opt.ProgressInterval = DefaultProgressInterval
+	}
+
+	return
 }
@@ -0,0 +1,144 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package progress module.
+
+package teos3
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is default minimal interval between progress
+// callback calls.
+const DefaultProgressInterval = 200 * time.Millisecond
+
+// Progress contains progress of copy operation. The progress of recursive
+// copy contains all copied files.
+type Progress struct {
+
+	// Source is the copied source argument.
+	Source string
+
+	// Done is the number of copied bytes.
+	Done int64
+
+	// Total is the number of bytes to copy, -1 if it is unknown.
+	Total int64
+
+	// Rate is the average copy rate in bytes per second.
+	Rate float64
+
+	// ETA is the estimated time remaining, 0 if it is unknown.
+	ETA time.Duration
+
+	// Finished is true in the last progress of copy operation.
+	Finished bool
+}
+
+// ProgressFunc is the callback function which receives copy progress.
+type ProgressFunc func(p Progress)
+
+// progress counts copied bytes of one or more concurrent readers and calls
+// progress function not more often than interval.
+type progress struct {
+	source   string
+	fn       ProgressFunc
+	interval time.Duration
+	total    int64
+	start    time.Time
+
+	mut  sync.Mutex
+	done int64
+	last time.Time
+}
+
+// newProgress creates progress of source copy with total size. The nil
+// progress is returned if fn is nil, the nil progress methods do nothing.
+func newProgress(source string, total int64, fn ProgressFunc,
+	interval time.Duration) *progress {
+
+	if fn == nil {
+		return nil
+	}
+	if interval <= 0 {
+		interval = DefaultProgressInterval
+	}
+	now := time.Now()
+	return &progress{
+		source:   source,
+		fn:       fn,
+		interval: interval,
+		total:    total,
+		start:    now,
+		last:     now,
+	}
+}
+
+// reader returns reader which adds read bytes to progress.
+func (p *progress) reader(reader io.Reader) io.Reader {
+	if p == nil {
+		return reader
+	}
+	return &progressReader{reader, p}
+}
+
+// add adds n copied bytes to progress and reports it if interval elapsed.
+func (p *progress) add(n int64) {
+	if p == nil {
+		return
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+
+	p.done += n
+	if now := time.Now(); now.Sub(p.last) >= p.interval {
+		p.last = now
+		p.report(false)
+	}
+}
+
+// finish reports last progress.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mut.Lock()
+	defer p.mut.Unlock()
+	p.report(true)
+}
+
+// report calls progress function with current progress. It should be called
+// under lock.
+func (p *progress) report(finished bool) {
+	pr := Progress{
+		Source:   p.source,
+		Done:     p.done,
+		Total:    p.total,
+		Finished: finished,
+	}
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		pr.Rate = float64(p.done) / elapsed
+	}
+	if pr.Total >= 0 && pr.Rate > 0 && !finished {
+		pr.ETA = time.Duration(float64(max(pr.Total-pr.Done, 0)) / pr.Rate *
+			float64(time.Second))
+	}
+	p.fn(pr)
+}
+
+// progressReader is reader which adds read bytes to progress.
+type progressReader struct {
+	io.Reader
+	p *progress
+}
+
+// Read reads data from reader and adds it to progress.
+func (r *progressReader) Read(b []byte) (n int, err error) {
+	n, err = r.Reader.Read(b)
+	r.p.add(int64(n))
+	return
+}
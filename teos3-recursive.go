@@ -0,0 +1,251 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package recursive operations module.
+
+package teos3
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// removeObjectsBatch is the maximum number of objects removed by one
+// RemoveObjects request.
+const removeObjectsBatch = 1000
+
+// Summary contains result of folder Copy, Move or Del.
+type Summary struct {
+
+	// Objects is the number of copied, moved or removed objects.
+	Objects int64
+
+	// Bytes is the size of copied, moved or removed objects.
+	Bytes int64
+
+	// Skipped is the number of source objects skipped by CopyOptions
+	// Overwrite mode.
+	Skipped int64
+
+	// Failed contains errors of objects which were not processed.
+	Failed []*KeyError
+}
+
+// KeyError is the error of object processed in folder Copy, Move or Del.
+type KeyError struct {
+	Key string
+	Err error
+}
+
+// Error returns key and error message.
+func (e *KeyError) Error() string { return e.Key + ": " + e.Err.Error() }
+
+// Unwrap returns object error.
+func (e *KeyError) Unwrap() error { return e.Err }
+
+// summary collects Summary of concurrent workers.
+type summary struct {
+	Summary
+	mut sync.Mutex
+}
+
+// done adds processed object to summary.
+func (s *summary) done(obj minio.ObjectInfo) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.Objects++
+	s.Bytes += max(obj.Size, 0)
+}
+
+// skip adds skipped object to summary.
+func (s *summary) skip() {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.Skipped++
+}
+
+// fail adds object error to summary.
+func (s *summary) fail(key string, err error) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.Failed = append(s.Failed, &KeyError{key, err})
+}
+
+// add adds sum to summary.
+func (s *summary) add(sum Summary) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+	s.Objects += sum.Objects
+	s.Bytes += sum.Bytes
+	s.Skipped += sum.Skipped
+	s.Failed = append(s.Failed, sum.Failed...)
+}
+
+// result sets out Summary if it is not nil and returns err joined with
+// objects errors.
+func (s *summary) result(out *Summary, err error) error {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if out != nil {
+		*out = s.Summary
+	}
+
+	errs := []error{err}
+	for _, e := range s.Failed {
+		errs = append(errs, e)
+	}
+	return errors.Join(errs...)
+}
+
+// summaryInfo returns info of object by key. The info contains key and -1
+// size if summary is nil or the object does not exist.
+func (m *TeoS3) summaryInfo(ctx context.Context, key string,
+	summary *Summary) (info minio.ObjectInfo) {
+
+	info.Key, info.Size = key, -1
+	if summary == nil {
+		return
+	}
+	if i, err := m.GetInfo(key, &GetInfoOptions{Context: ctx}); err == nil {
+		info = i
+	}
+	return
+}
+
+// walk lists all objects of folder key recursively and calls callback
+// function for each object in workers concurrent goroutines. The listed is
+// true if at least one object was listed.
+func (m *TeoS3) walk(ctx context.Context, key string, workers int,
+	callback func(obj minio.ObjectInfo)) (listed bool, err error) {
+
+	// Start workers
+	var wg sync.WaitGroup
+	objects := make(chan minio.ObjectInfo)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range objects {
+				callback(obj)
+			}
+		}()
+	}
+
+	// List objects recursively
+	opt := m.getListOptions(key, &ListOptions{Context: ctx})
+	opt.Recursive = true
+	err = m.listObjects(opt, func(obj minio.ObjectInfo) bool {
+		select {
+		case objects <- obj:
+			listed = true
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(objects)
+	wg.Wait()
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return
+}
+
+// remover removes objects of TeoS3 by RemoveObjects batches in concurrent
+// requests. The done function is called for each removed object and the fail
+// function is called for each object which was not removed.
+type remover struct {
+	m       *TeoS3
+	ctx     context.Context
+	opts    minio.RemoveObjectsOptions
+	done    func(obj minio.ObjectInfo)
+	fail    func(key string, err error)
+	mut     sync.Mutex
+	batch   []minio.ObjectInfo
+	batches chan []minio.ObjectInfo
+	wg      sync.WaitGroup
+}
+
+// newRemover creates remover and starts its workers. The remover should be
+// closed after all objects added.
+func (m *TeoS3) newRemover(ctx context.Context, workers int,
+	opts minio.RemoveObjectsOptions, done func(obj minio.ObjectInfo),
+	fail func(key string, err error)) (r *remover) {
+
+	r = &remover{
+		m:       m,
+		ctx:     ctx,
+		opts:    opts,
+		done:    done,
+		fail:    fail,
+		batches: make(chan []minio.ObjectInfo),
+	}
+	for range workers {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for batch := range r.batches {
+				r.remove(batch)
+			}
+		}()
+	}
+	return
+}
+
+// add adds object to current batch and sends full batch to workers. It is
+// safe to call add from concurrent goroutines.
+func (r *remover) add(obj minio.ObjectInfo) {
+	r.mut.Lock()
+	defer r.mut.Unlock()
+
+	r.batch = append(r.batch, obj)
+	if len(r.batch) == removeObjectsBatch {
+		r.batches <- r.batch
+		r.batch = nil
+	}
+}
+
+// close sends last batch to workers and waits until all batches are removed.
+func (r *remover) close() {
+	if len(r.batch) > 0 {
+		r.batches <- r.batch
+	}
+	close(r.batches)
+	r.wg.Wait()
+}
+
+// remove removes batch of objects by one RemoveObjects request.
+func (r *remover) remove(batch []minio.ObjectInfo) {
+
+	objectsCh := make(chan minio.ObjectInfo, len(batch))
+	for _, obj := range batch {
+		obj.Key = r.m.key(obj.Key)
+		objectsCh <- obj
+	}
+	close(objectsCh)
+
+	// Get not removed objects
+	failed := make(map[string]bool)
+	errs := r.m.con.RemoveObjects(r.ctx, r.m.bucket, objectsCh, r.opts)
+	for e := range errs {
+		key := strings.TrimPrefix(e.ObjectName, r.m.prefix)
+		failed[key] = true
+		r.fail(key, wrapError(e.Err))
+	}
+
+	if r.done == nil {
+		return
+	}
+	for _, obj := range batch {
+		if !failed[obj.Key] {
+			r.done(obj)
+		}
+	}
+}
@@ -0,0 +1,568 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The TeoS3 package sync module.
+
+package teos3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// SyncStateFile is the name of file in local directory which contains state
+// of last two-way Sync. This file is not synchronized.
+const SyncStateFile = ".teos3sync"
+
+// syncModTimeKey is the user metadata key of uploaded object which contains
+// local file modification time.
+const syncModTimeKey = "Mtime"
+
+// SyncOp is the operation of Sync action.
+type SyncOp int
+
+// Sync operations
+const (
+	SyncUpload       SyncOp = iota // Copy local file to s3 object
+	SyncDownload                   // Copy s3 object to local file
+	SyncRemoveLocal                // Remove local file
+	SyncRemoveRemote               // Remove s3 object
+	SyncConflict                   // File changed on both sides
+)
+
+// String returns operation name.
+func (op SyncOp) String() string {
+	switch op {
+	case SyncUpload:
+		return "upload"
+	case SyncDownload:
+		return "download"
+	case SyncRemoveLocal:
+		return "remove local"
+	case SyncRemoveRemote:
+		return "remove remote"
+	case SyncConflict:
+		return "conflict"
+	}
+	return "unknown"
+}
+
+// SyncAction is the Sync action of one file.
+type SyncAction struct {
+	Op   SyncOp
+	Name string // Slash separated file name inside synchronized folders
+	Size int64  // Copied file size
+}
+
+// Sync synchronizes local directory and s3 folder using connection con. One
+// of source and target is local directory, other is s3 folder defined with
+// 's3:' or 's3://bucket/' prefix the same as in CopyWith. The options
+// parameter may be omitted and than default SyncOptions with connection
+// context used.
+//
+// Only changed files are copied from source to target. The local file and
+// s3 object are in sync if they have the same size and modification time.
+// The local file modification time is saved in the uploaded object user
+// metadata and is set to downloaded file, the object LastModified is used if
+// object has no such metadata. With opt.Checksum the files with different
+// modification time are compared by MD5, and equal files get the same
+// modification time: the s3 object metadata is updated in one-way upload and
+// the local file modification time otherwise.
+//
+// In opt.TwoWay mode the changes of both sides are copied, the source and
+// target order does not matter. The file changed on both sides since last
+// sync is not copied and is returned as ErrSyncConflict error.
+//
+// The files errors are joined and returned after all files processed.
+//
+//	err := teos3.Sync(con, "photos", "s3:backup/photos",
+//		&teos3.SyncOptions{Delete: true, Exclude: []string{"*.tmp"}})
+func Sync(con *TeoS3, source, target string, options ...*SyncOptions) (
+	err error) {
+
+	// Set options
+	opt := con.getSyncOptions(options...)
+
+	// Check arguments
+	src, dst := parseCopyArg(con, source), parseCopyArg(con, target)
+	if src.s3 == dst.s3 || src.std || dst.std {
+		return fmt.Errorf("sync between local directory and s3 folder " +
+			"supported only")
+	}
+	for _, pattern := range append(opt.Include, opt.Exclude...) {
+		if _, err = path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("wrong pattern %q: %w", pattern, err)
+		}
+	}
+	s := &syncer{local: src, remote: dst, upload: true, opt: opt}
+	if src.s3 {
+		s.local, s.remote, s.upload = dst, src, false
+	}
+
+	// List local and s3 files and get actions
+	if err = s.list(); err != nil {
+		return
+	}
+	s.compare()
+	actions := s.actions()
+
+	// Report actions
+	if opt.Action != nil {
+		for _, a := range actions {
+			opt.Action(a.SyncAction)
+		}
+	}
+	if opt.DryRun {
+		return s.sum.result(opt.Summary, nil)
+	}
+
+	// Execute actions
+	var total int64
+	for _, a := range actions {
+		total += a.Size
+	}
+	p := newProgress(src.name, total, opt.Progress, opt.ProgressInterval)
+	syncEach(opt.Context, opt.Workers, actions, func(a *syncItem) {
+		s.execute(a, p)
+	})
+	if err = opt.Context.Err(); err == nil {
+		p.finish()
+	}
+
+	// Save state of two-way sync
+	if opt.TwoWay {
+		if e := s.saveState(); e != nil {
+			err = errors.Join(err, e)
+		}
+	}
+
+	return s.sum.result(opt.Summary, err)
+}
+
+// syncer synchronizes local directory and s3 folder.
+type syncer struct {
+	local  copyArg
+	remote copyArg
+	upload bool // One-way sync direction
+	opt    *SyncOptions
+	sum    summary
+
+	items map[string]*syncItem
+	state syncState
+}
+
+// syncItem is the file of local directory and s3 folder.
+type syncItem struct {
+	SyncAction
+	local  *copyEntry
+	remote *copyEntry
+	state  *syncStateEntry
+	inSync bool
+}
+
+// syncState is the state of last two-way sync by file name.
+type syncState map[string]*syncStateEntry
+
+// syncStateEntry is the state of file synchronized by last two-way sync.
+type syncStateEntry struct {
+	Size    int64
+	ModTime time.Time
+	ETag    string
+}
+
+// list lists local and s3 files and reads two-way sync state.
+func (s *syncer) list() (err error) {
+	s.items = make(map[string]*syncItem)
+	item := func(name string) *syncItem {
+		i, ok := s.items[name]
+		if !ok {
+			i = &syncItem{SyncAction: SyncAction{Name: name}}
+			s.items[name] = i
+		}
+		return i
+	}
+
+	// List local directory, the not existing target directory is empty
+	entries, err := listFolder(s.opt.Context, s.local)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && (!s.upload || s.opt.TwoWay):
+		err = nil
+	case err != nil:
+		return
+	}
+	for _, e := range entries {
+		if s.included(e.name) {
+			item(e.name).local = &e
+		}
+	}
+
+	// List s3 folder, the not existing folder is empty
+	entries, err = listFolder(s.opt.Context, s.remote)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		err = nil
+	case err != nil:
+		return
+	}
+	for _, e := range entries {
+		switch {
+		case !s.included(e.name):
+		case !filepath.IsLocal(filepath.FromSlash(e.name)):
+			s.sum.fail(s.remote.join(e.name).name,
+				errors.New("invalid file name"))
+		default:
+			item(e.name).remote = &e
+		}
+	}
+
+	// Read state of last two-way sync
+	if !s.opt.TwoWay {
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(s.local.key, SyncStateFile))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return
+	}
+	if err = json.Unmarshal(data, &s.state); err != nil {
+		return fmt.Errorf("wrong sync state file: %w", err)
+	}
+	for name, st := range s.state {
+		if s.included(name) {
+			item(name).state = st
+		}
+	}
+	return
+}
+
+// included returns true if file name is synchronized. The folders and state
+// file are not synchronized.
+func (s *syncer) included(name string) bool {
+	switch {
+	case isFolder(name), name == SyncStateFile:
+		return false
+	case len(s.opt.Include) > 0 && !syncMatch(s.opt.Include, name):
+		return false
+	}
+	return !syncMatch(s.opt.Exclude, name)
+}
+
+// syncMatch returns true if name matches one of glob patterns. The pattern
+// without '/' matches any element of name, the pattern with '/' matches name
+// or its parent folder.
+func syncMatch(patterns []string, name string) bool {
+	elems := strings.Split(name, "/")
+	for _, pattern := range patterns {
+		pattern = strings.Trim(pattern, "/")
+		for i := range elems {
+			subject := elems[i]
+			if strings.Contains(pattern, "/") {
+				subject = strings.Join(elems[:i+1], "/")
+			}
+			if ok, _ := path.Match(pattern, subject); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compare sets inSync flag of files which exist on both sides. The s3 object
+// modification time is read from its metadata and MD5 of local file is
+// calculated in opt.Workers concurrent goroutines. The modification times of
+// files with equal MD5 are updated.
+func (s *syncer) compare() {
+	var items []*syncItem
+	for _, i := range s.items {
+		if i.local != nil && i.remote != nil && i.local.size == i.remote.size {
+			items = append(items, i)
+		}
+	}
+	syncEach(s.opt.Context, s.opt.Workers, items, func(i *syncItem) {
+
+		// Get s3 object modification time from metadata
+		info, err := s.remote.con.GetInfo(s.remote.join(i.Name).key,
+			&GetInfoOptions{Context: s.opt.Context})
+		if err != nil {
+			return
+		}
+		i.remote.modTime = syncModTime(info)
+		if i.local.modTime.Equal(i.remote.modTime) {
+			i.inSync = true
+			return
+		}
+
+		// Compare MD5 of local file and single part s3 object ETag
+		etag := strings.Trim(i.remote.etag, `"`)
+		if !s.opt.Checksum || etag == "" || isMultipartETag(etag) {
+			return
+		}
+		sum, err := fileChecksum(s.local.join(i.Name).key, -1,
+			ChecksumMD5)
+		if err != nil || sum != etag {
+			return
+		}
+		i.inSync = true
+		s.setModTime(i, etag)
+	})
+}
+
+// setModTime sets the same modification time to local file and s3 object
+// with equal content, so they are not compared by MD5 in next sync. The s3
+// object metadata is changed in one-way upload, local file modification time
+// otherwise. Nothing is changed in opt.DryRun mode. The error is skipped as
+// the file is in sync and will be compared by MD5 again.
+func (s *syncer) setModTime(i *syncItem, etag string) {
+	if s.opt.DryRun {
+		return
+	}
+
+	// Save local modification time to s3 object metadata if object was not
+	// changed after its MD5 compared
+	if s.upload && !s.opt.TwoWay {
+		key := s.remote.join(i.Name).key
+		err := s.remote.con.Copy(key, key, &CopyOptions{
+			Context:   s.opt.Context,
+			Overwrite: OverwriteAlways,
+			Metadata:  MetadataMerge,
+			UserMetadata: map[string]string{
+				syncModTimeKey: i.local.modTime.Format(time.RFC3339Nano),
+			},
+			MatchETag: etag,
+		})
+		if err == nil {
+			i.remote.modTime = i.local.modTime
+		}
+		return
+	}
+
+	// Set s3 object modification time to local file
+	modTime := i.remote.modTime
+	if os.Chtimes(s.local.join(i.Name).key, modTime, modTime) == nil {
+		i.local.modTime = modTime
+	}
+}
+
+// actions returns sorted by name actions of files which are not in sync.
+func (s *syncer) actions() (actions []*syncItem) {
+	for _, i := range s.items {
+		op, ok := s.action(i)
+		switch {
+		case !ok && i.inSync:
+			s.sum.skip()
+			continue
+		case !ok:
+			continue
+		case op == SyncConflict:
+			s.sum.fail(i.Name, ErrSyncConflict)
+		case op == SyncUpload:
+			i.Size = i.local.size
+		case op == SyncDownload:
+			i.Size = i.remote.size
+		}
+		i.Op = op
+		actions = append(actions, i)
+	}
+	sort.Slice(actions, func(a, b int) bool {
+		return actions[a].Name < actions[b].Name
+	})
+	return
+}
+
+// action returns action of file, ok is false if file is in sync.
+func (s *syncer) action(i *syncItem) (op SyncOp, ok bool) {
+
+	// One-way sync
+	if !s.opt.TwoWay {
+		switch {
+		case i.inSync:
+			return
+		case s.upload && i.local != nil:
+			return SyncUpload, true
+		case !s.upload && i.remote != nil:
+			return SyncDownload, true
+		case s.opt.Delete && s.upload:
+			return SyncRemoveRemote, true
+		case s.opt.Delete:
+			return SyncRemoveLocal, true
+		}
+		return
+	}
+
+	// Two-way sync, the changes are detected by last sync state
+	st := i.state
+	localChanged := i.local != nil && (st == nil ||
+		i.local.size != st.Size || !i.local.modTime.Equal(st.ModTime))
+	remoteChanged := i.remote != nil && (st == nil ||
+		strings.Trim(i.remote.etag, `"`) != st.ETag)
+
+	switch {
+	case i.inSync || i.local == nil && i.remote == nil:
+		return
+	case i.local != nil && i.remote != nil:
+		switch {
+		case localChanged && !remoteChanged:
+			return SyncUpload, true
+		case remoteChanged && !localChanged:
+			return SyncDownload, true
+		}
+		return SyncConflict, true
+
+	// Removed on other side after last sync
+	case i.local != nil && st != nil && !localChanged && s.opt.Delete:
+		return SyncRemoveLocal, true
+	case i.remote != nil && st != nil && !remoteChanged && s.opt.Delete:
+		return SyncRemoveRemote, true
+
+	// Created or restored
+	case i.local != nil:
+		return SyncUpload, true
+	}
+	return SyncDownload, true
+}
+
+// execute executes action and adds it to summary.
+func (s *syncer) execute(i *syncItem, p *progress) {
+	local, remote := s.local.join(i.Name), s.remote.join(i.Name)
+	copyOpt := &CopyWithOptions{Context: s.opt.Context}
+
+	var err error
+	switch i.Op {
+	case SyncConflict:
+		return
+
+	case SyncUpload:
+		// Save local modification time to s3 object metadata
+		meta := map[string]string{
+			syncModTimeKey: i.local.modTime.Format(time.RFC3339Nano),
+		}
+		var info minio.ObjectInfo
+		info, err = copyFile(local, remote, copyOpt, p, meta)
+		if err == nil {
+			i.remote = &copyEntry{name: i.Name, size: info.Size,
+				etag: info.ETag}
+		}
+
+	case SyncDownload:
+		// Set s3 object modification time to local file
+		var info minio.ObjectInfo
+		if err = makeParent(local); err == nil {
+			info, err = copyFile(remote, local, copyOpt, p, nil)
+		}
+		if err == nil {
+			modTime := syncModTime(info)
+			err = os.Chtimes(local.key, modTime, modTime)
+			i.local = &copyEntry{name: i.Name, size: info.Size,
+				modTime: modTime}
+		}
+
+	case SyncRemoveLocal:
+		if err = os.Remove(local.key); err == nil {
+			i.local = nil
+		}
+
+	case SyncRemoveRemote:
+		err = s.remote.con.Del(remote.key, &DelOptions{Context: s.opt.Context})
+		if err == nil {
+			i.remote = nil
+		}
+	}
+
+	if err != nil {
+		s.sum.fail(i.Name, err)
+		return
+	}
+	i.inSync = true
+	s.sum.done(minio.ObjectInfo{Key: i.Name, Size: i.Size})
+}
+
+// saveState saves state of files which are in sync to local state file. The
+// file is replaced atomically so interrupted sync does not break it.
+func (s *syncer) saveState() error {
+	state := make(syncState)
+	for name, i := range s.items {
+		switch {
+		case i.inSync && i.local != nil && i.remote != nil:
+			state[name] = &syncStateEntry{
+				Size:    i.local.size,
+				ModTime: i.local.modTime,
+				ETag:    strings.Trim(i.remote.etag, `"`),
+			}
+		case !i.inSync && i.state != nil && (i.local != nil || i.remote != nil):
+			// Keep state of conflicted and failed files
+			state[name] = i.state
+		}
+	}
+
+	// Keep state of files excluded from this sync
+	for name, st := range s.state {
+		if !s.included(name) {
+			state[name] = st
+		}
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(s.local.key, 0755); err != nil {
+		return err
+	}
+	return saveFile(filepath.Join(s.local.key, SyncStateFile),
+		bytes.NewReader(data), func(n int64) error { return nil })
+}
+
+// syncModTime returns local file modification time saved in s3 object
+// metadata or object LastModified.
+func syncModTime(info minio.ObjectInfo) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, info.UserMetadata[syncModTimeKey])
+	if err != nil {
+		return info.LastModified
+	}
+	return t
+}
+
+// syncEach calls fn for each item in workers concurrent goroutines until
+// context canceled.
+func syncEach[T any](ctx context.Context, workers int, items []T,
+	fn func(item T)) {
+
+	var wg sync.WaitGroup
+	ch := make(chan T)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range ch {
+				fn(item)
+			}
+		}()
+	}
+
+send:
+	for _, item := range items {
+		select {
+		case ch <- item:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(ch)
+	wg.Wait()
+}
@@ -0,0 +1,296 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/teonet-go/teos3"
+)
+
+// syncStep is the Sync test step: the local files and s3 folder objects are
+// changed and synchronized. The "-" data removes file or object.
+type syncStep struct {
+	files       map[string]string // Changed local files
+	objects     map[string]string // Changed s3 objects
+	actions     []string          // Actions in 'op: name' format
+	skipped     int64             // Number of files in sync
+	err         error
+	wantFiles   map[string]string // Local files after sync if not nil
+	wantObjects map[string]string // S3 objects after sync if not nil
+}
+
+// The local directory is synchronized to s3 folder if upload is set
+func TestSync(t *testing.T) {
+	files := map[string]string{"a": "a", "sub/b": "bb"}
+	both := map[string]string{"a": "a", "b": "bb"}
+
+	tests := []struct {
+		name   string
+		opt    teos3.SyncOptions
+		upload bool
+		steps  []syncStep
+	}{
+		{name: "upload", upload: true, steps: []syncStep{
+			{files: files, actions: []string{"upload: a", "upload: sub/b"},
+				wantObjects: files},
+			{skipped: 2, wantFiles: files, wantObjects: files},
+			{files: map[string]string{"a": "aaa"},
+				actions: []string{"upload: a"}, skipped: 1,
+				wantObjects: map[string]string{"a": "aaa", "sub/b": "bb"}},
+			{files: map[string]string{"sub/b": "-"}, skipped: 1,
+				wantObjects: map[string]string{"a": "aaa", "sub/b": "bb"}},
+		}},
+		{name: "upload with delete", upload: true,
+			opt: teos3.SyncOptions{Delete: true}, steps: []syncStep{
+				{files: files, actions: []string{"upload: a",
+					"upload: sub/b"}, wantObjects: files},
+				{files: map[string]string{"sub/b": "-"},
+					actions: []string{"remove remote: sub/b"}, skipped: 1,
+					wantObjects: map[string]string{"a": "a"}},
+				{skipped: 1, wantObjects: map[string]string{"a": "a"}},
+			}},
+		{name: "download", steps: []syncStep{
+			{objects: files, actions: []string{"download: a",
+				"download: sub/b"}, wantFiles: files},
+			{skipped: 2, wantFiles: files, wantObjects: files},
+			{objects: map[string]string{"a": "aaa"},
+				actions: []string{"download: a"}, skipped: 1,
+				wantFiles: map[string]string{"a": "aaa", "sub/b": "bb"}},
+		}},
+		{name: "download with delete", opt: teos3.SyncOptions{Delete: true},
+			steps: []syncStep{
+				{objects: files, actions: []string{"download: a",
+					"download: sub/b"}, wantFiles: files},
+				{objects: map[string]string{"a": "-"},
+					actions: []string{"remove local: a"}, skipped: 1,
+					wantFiles: map[string]string{"sub/b": "bb"}},
+				{skipped: 1, wantFiles: map[string]string{"sub/b": "bb"}},
+			}},
+		{name: "checksum", upload: true,
+			opt: teos3.SyncOptions{Checksum: true}, steps: []syncStep{
+				{files: files, actions: []string{"upload: a",
+					"upload: sub/b"}},
+				// The rewritten file has new modification time
+				{files: map[string]string{"a": "a"}, skipped: 2},
+			}},
+		{name: "exclude", upload: true,
+			opt: teos3.SyncOptions{Exclude: []string{"sub"}},
+			steps: []syncStep{
+				{files: files, actions: []string{"upload: a"},
+					wantObjects: map[string]string{"a": "a"}},
+				{skipped: 1},
+			}},
+		{name: "changes", opt: teos3.SyncOptions{TwoWay: true},
+			steps: []syncStep{
+				{files: map[string]string{"a": "a"},
+					objects:   map[string]string{"b": "bb"},
+					actions:   []string{"upload: a", "download: b"},
+					wantFiles: both, wantObjects: both},
+				{skipped: 2, wantFiles: both, wantObjects: both},
+				{files: map[string]string{"a": "aaa"},
+					objects:   map[string]string{"b": "bbbb"},
+					actions:   []string{"upload: a", "download: b"},
+					wantFiles: map[string]string{"a": "aaa", "b": "bbbb"},
+					wantObjects: map[string]string{"a": "aaa",
+						"b": "bbbb"}},
+				{skipped: 2},
+			}},
+		{name: "conflict", opt: teos3.SyncOptions{TwoWay: true},
+			steps: []syncStep{
+				{files: both, actions: []string{"upload: a", "upload: b"}},
+				{files: map[string]string{"b": "local"},
+					objects: map[string]string{"b": "remote"},
+					actions: []string{"conflict: b"}, skipped: 1,
+					err:       teos3.ErrSyncConflict,
+					wantFiles: map[string]string{"a": "a", "b": "local"},
+					wantObjects: map[string]string{"a": "a",
+						"b": "remote"}},
+				// The conflict is reported until it is resolved
+				{actions: []string{"conflict: b"}, skipped: 1,
+					err: teos3.ErrSyncConflict},
+				// The removed local file is restored from changed object
+				{files: map[string]string{"b": "-"},
+					actions: []string{"download: b"}, skipped: 1,
+					wantFiles: map[string]string{"a": "a", "b": "remote"}},
+				{skipped: 2},
+			}},
+		{name: "delete", opt: teos3.SyncOptions{TwoWay: true, Delete: true},
+			steps: []syncStep{
+				{files: map[string]string{"a": "a"},
+					objects: map[string]string{"b": "bb"},
+					actions: []string{"upload: a", "download: b"}},
+				{files: map[string]string{"a": "-"},
+					objects:     map[string]string{"b": "-"},
+					actions:     []string{"remove remote: a", "remove local: b"},
+					wantFiles:   map[string]string{},
+					wantObjects: map[string]string{}},
+				{wantFiles: map[string]string{},
+					wantObjects: map[string]string{}},
+			}},
+		{name: "restore without delete", opt: teos3.SyncOptions{TwoWay: true},
+			steps: []syncStep{
+				{files: both, actions: []string{"upload: a", "upload: b"}},
+				{files: map[string]string{"a": "-"},
+					actions: []string{"download: a"}, skipped: 1,
+					wantFiles: both},
+			}},
+	}
+	for _, tt := range tests {
+		for backend, con := range connections(t, nil) {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				const folder = "sync/"
+				dir := t.TempDir()
+				args := []string{dir, "s3:" + folder}
+				if !tt.upload {
+					args[0], args[1] = args[1], args[0]
+				}
+				remote := con.WithPrefix(folder)
+
+				for i, step := range tt.steps {
+
+					// Change local files and s3 objects
+					for name, data := range step.files {
+						if data == "-" {
+							os.Remove(filepath.Join(dir,
+								filepath.FromSlash(name)))
+							continue
+						}
+						writeFiles(t, dir, map[string]string{name: data})
+					}
+					for key, data := range step.objects {
+						err := remote.Set(key, []byte(data))
+						if data == "-" {
+							err = remote.Del(key)
+						}
+						if err != nil {
+							t.Fatal(err)
+						}
+					}
+
+					// Synchronize
+					var actions []string
+					var sum teos3.Summary
+					opt := tt.opt
+					opt.Summary = &sum
+					opt.Action = func(a teos3.SyncAction) {
+						actions = append(actions, a.Op.String()+": "+a.Name)
+					}
+					err := teos3.Sync(con, args[0], args[1], &opt)
+					switch {
+					case !errors.Is(err, step.err):
+						t.Fatalf("step %d: got error %v, want %v", i, err,
+							step.err)
+					case !slices.Equal(actions, step.actions):
+						t.Fatalf("step %d: got actions %q, want %q", i,
+							actions, step.actions)
+					case sum.Skipped != step.skipped:
+						t.Fatalf("step %d: got %d skipped files, want %d", i,
+							sum.Skipped, step.skipped)
+					}
+
+					// Check local files and s3 objects
+					files := readFiles(t, dir)
+					delete(files, teos3.SyncStateFile)
+					if step.wantFiles != nil &&
+						!maps.Equal(files, step.wantFiles) {
+						t.Fatalf("step %d: got files %v, want %v", i, files,
+							step.wantFiles)
+					}
+					objects := readObjects(t, remote)
+					if step.wantObjects != nil &&
+						!maps.Equal(objects, step.wantObjects) {
+						t.Fatalf("step %d: got objects %v, want %v", i,
+							objects, step.wantObjects)
+					}
+				}
+			})
+		}
+	}
+}
+
+// The files with changed modification time and equal MD5 are compared by
+// MD5 once
+func TestSyncChecksum(t *testing.T) {
+	files := map[string]string{"a": "a", "sub/b": "bb"}
+	past := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		opt     teos3.SyncOptions
+		upload  bool
+		dryRun  bool
+		actions []string // Actions of sync without checksum
+	}{
+		{name: "upload", upload: true},
+		{name: "download"},
+		{name: "two-way", opt: teos3.SyncOptions{TwoWay: true}},
+		{name: "dry run", upload: true, dryRun: true,
+			actions: []string{"upload: a", "upload: sub/b"}},
+	}
+	for _, tt := range tests {
+		for backend, con := range connections(t, nil) {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				dir := t.TempDir()
+				args := []string{dir, "s3:sync/"}
+				if tt.upload || tt.opt.TwoWay {
+					writeFiles(t, dir, files)
+				} else {
+					args[0], args[1] = args[1], args[0]
+					setObjects(t, con.WithPrefix("sync/"), files)
+				}
+				err := teos3.Sync(con, args[0], args[1], &tt.opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				// Change local files modification time
+				for name := range files {
+					name = filepath.Join(dir, filepath.FromSlash(name))
+					if err := os.Chtimes(name, past, past); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				// Synchronize with and without checksum
+				for i, checksum := range []bool{true, false} {
+					var actions []string
+					var sum teos3.Summary
+					opt := tt.opt
+					opt.Checksum, opt.DryRun = checksum, tt.dryRun && checksum
+					opt.Summary = &sum
+					opt.Action = func(a teos3.SyncAction) {
+						actions = append(actions, a.Op.String()+": "+a.Name)
+					}
+					want := tt.actions
+					if checksum {
+						want = nil
+					}
+					err := teos3.Sync(con, args[0], args[1], &opt)
+					switch {
+					case err != nil:
+						t.Fatal(err)
+					case !slices.Equal(actions, want):
+						t.Fatalf("step %d: got actions %q, want %q", i,
+							actions, want)
+					case sum.Skipped != int64(len(files)-len(want)):
+						t.Fatalf("step %d: got %d skipped files, want %d", i,
+							sum.Skipped, len(files)-len(want))
+					}
+				}
+				got := readObjects(t, con.WithPrefix("sync/"))
+				if !maps.Equal(got, files) {
+					t.Fatalf("got objects %v, want %v", got, files)
+				}
+			})
+		}
+	}
+}
@@ -13,26 +13,23 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"path/filepath"
+	"reflect"
+	"strings"
 	"sync"
 
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
 )
 
 const Version = "0.1.2"
 
 const teoS3bucket = "teos3"
 
-var ErrDestinationObjectAlreadyExists = errors.New(
-	"destination object already exists",
-)
-
 // TeoS3 objects data and methods receiver
 type TeoS3 struct {
 	context context.Context
-	con     *minio.Client
+	con     Backend
 	bucket  string
+	prefix  string
 }
 
 // MapData is data structure used in ListBody output
@@ -46,18 +43,29 @@ type MapData struct {
 // name used). The enpoind argument must be specified without http/https
 // prefix(just domain and path), and the secure argument defines HTTPS if true
 // or HTTP if false.
+//
+// Use New to connect with additional options.
 func Connect(accessKey, secretKey, endpoint string, secure bool,
 	buckets ...string) (teos3 *TeoS3, err error) {
 
+	options := []Option{
+		WithCredentials(accessKey, secretKey),
+		WithSecure(secure),
+	}
+	if len(buckets) > 0 {
+		options = append(options, WithDefaultBucket(buckets[0]))
+	}
+
+	return New(endpoint, options...)
+}
+
+// ConnectBackend creates new TeoS3 object which uses backend storage and
+// bucket (if omitted then default 'teos3' buckets name used).
+func ConnectBackend(backend Backend, buckets ...string) (teos3 *TeoS3) {
+
 	teos3 = new(TeoS3)
 	teos3.context = context.Background()
-
-	if teos3.con, err = minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
-		Secure: secure,
-	}); err != nil {
-		return
-	}
+	teos3.con = backend
 
 	if len(buckets) > 0 && len(buckets[0]) > 0 {
 		teos3.bucket = buckets[0]
@@ -68,11 +76,40 @@ func Connect(accessKey, secretKey, endpoint string, secure bool,
 }
 
 // SetContext sets context which will be used in all TeS3 operations if another
-// context does not send in function call options argument.
+// context does not send in function call options argument. The nil ctx sets
+// context.Background.
 func (m *TeoS3) SetContext(ctx context.Context) *TeoS3 {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	m.context = ctx
 	return m
 }
 
+// WithBucket returns TeoS3 view of the bucket which shares the connection
+// with m. The view keeps m prefix and context.
+func (m *TeoS3) WithBucket(bucket string) *TeoS3 {
+	v := *m
+	v.bucket = bucket
+	return &v
+}
+
+// WithPrefix returns TeoS3 view of the prefix namespace which shares the
+// connection with m. All keys of the view are transparently prefixed in
+// requests and unprefixed in results, so the view has isolated keyspace.
+// The prefix is added to m prefix, so views may be nested.
+//
+//	tenant := con.WithPrefix("tenants/tenant-1/")
+//	err := tenant.Set("key", data) // saves "tenants/tenant-1/key"
+func (m *TeoS3) WithPrefix(prefix string) *TeoS3 {
+	v := *m
+	v.prefix = m.prefix + prefix
+	return &v
+}
+
+// Prefix returns TeoS3 keys prefix.
+func (m *TeoS3) Prefix() string { return m.prefix }
+
 // Set sets data to map by key. The options parameter may be omitted and
 // than default SetObjectOptions with context.Background and empty
 // minio.PutObjectOptions used.
@@ -82,19 +119,102 @@ func (m *TeoS3) Set(key string, data []byte, options ...*SetOptions) error {
 
 // SetObject sets object to map by key. The options parameter may be omitted
 // and than default SetObjectOptions with context.Background and empty
-// minio.PutObjectOptions used.
+// minio.PutObjectOptions used. If the options context is canceled during
+// multipart upload, the incomplete uploads of the object are aborted.
+//
+// If opt.StoreChecksum is set, the checksum of object is stored in object
+// user metadata. The checksum of objectSize bytes of io.ReadSeeker reader is
+// calculated before upload and verified while uploading, the upload fails
+// with ErrChecksumMismatch before object is committed if reader data changed.
+// The parts MD5 are sent to server which rejects data corrupted in transit.
+// The checksum of other readers is calculated while uploading and set to
+// metadata of uploaded object by second write, the server side copy of
+// object onto itself. Such upload larger than 5 GiB is refused. If the second
+// write fails, the object is uploaded without checksum and the returned error
+// wraps ErrChecksumNotStored.
 func (m *TeoS3) SetObject(key string, reader io.Reader, objectSize int64,
 	options ...*SetOptions) (err error) {
 
 	// Set options
 	opt := m.getSetOptions(options...)
 
-	_, err = m.con.PutObject(opt.Context, m.bucket, key, reader, objectSize,
-		minio.PutObjectOptions(opt.SetObjectOptions),
+	// Calculate checksum of seekable reader before upload
+	var sum string
+	if seeker, ok := reader.(io.ReadSeeker); ok && opt.StoreChecksum != "" {
+		sum, err = seekerChecksum(seeker, objectSize, opt.StoreChecksum)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = m.setObject(key, reader, objectSize, opt, sum)
+	return
+}
+
+// setObject sets object to map by key and returns upload info. If
+// opt.StoreChecksum is set the checksum is calculated while uploading. The
+// sum is checksum of reader calculated before upload, it is set to object
+// metadata and verified before the last data is uploaded. If sum is empty the
+// uploaded data checksum is set to metadata after upload.
+func (m *TeoS3) setObject(key string, reader io.Reader, objectSize int64,
+	opt *SetOptions, sum string) (info minio.UploadInfo, err error) {
+
+	// Calculate checksum while uploading
+	var r *uploadReader
+	if opt.StoreChecksum != "" {
+		if sum == "" && objectSize > maxCopyObjectSize {
+			err = fmt.Errorf("%s: %w", key, errChecksumSize)
+			return
+		}
+		r = &uploadReader{name: key, size: objectSize, sum: sum}
+		r.checksumReader, err = newChecksumReader(
+			limitReader(reader, objectSize), opt.StoreChecksum)
+		if err != nil {
+			return
+		}
+		reader = r
+		opt.SendContentMd5 = true
+	}
+
+	// Set checksum calculated before upload to metadata
+	if sum != "" {
+		meta := make(map[string]string, len(opt.UserMetadata)+1)
+		for k, v := range opt.UserMetadata {
+			meta[k] = v
+		}
+		meta[ChecksumMetaKey] = sum
+		opt.UserMetadata = meta
+	}
+
+	info, err = m.con.PutObject(opt.Context, m.bucket, m.key(key), reader,
+		objectSize, minio.PutObjectOptions(opt.SetObjectOptions),
 	)
+	if err != nil && opt.Context.Err() != nil {
+		m.removeIncompleteUpload(opt.Context, key)
+	}
+	if err = wrapError(err); err != nil || r == nil || sum != "" {
+		return
+	}
+
+	// Set checksum of uploaded data to metadata
+	err = m.setChecksum(opt.Context, key, info.ETag, r.checksum())
 	return
 }
 
+// removeIncompleteUpload aborts incomplete multipart uploads of object by
+// key if backend keeps them. The canceled context ctx is replaced by context
+// without cancel and with uploadAbortTimeout timeout.
+func (m *TeoS3) removeIncompleteUpload(ctx context.Context, key string) {
+	remover, ok := m.con.(UploadRemover)
+	if !ok {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx),
+		uploadAbortTimeout)
+	defer cancel()
+	remover.RemoveIncompleteUpload(ctx, m.bucket, m.key(key))
+}
+
 // Get map data by key. The options parameter may be omitted and than default
 // GetObjectOptions with context.Background and empty minio.SetObjectOptions
 // used.
@@ -112,6 +232,7 @@ func (m *TeoS3) Get(key string, options ...*GetOptions) (
 	buf := new(bytes.Buffer)
 	_, err = buf.ReadFrom(obj)
 	if err != nil {
+		err = wrapError(err)
 		return
 	}
 
@@ -123,15 +244,31 @@ func (m *TeoS3) Get(key string, options ...*GetOptions) (
 // GetObject gets map object by key. The options parameter may be omitted and
 // than default GetObjectOptions with context.Background and empty minio.
 // SetObjectOptions used. Returned object must be cloused with obj.Close()
-// after use.
+// after use. The GetObject returns error if the object does not exist.
 func (m *TeoS3) GetObject(key string, options ...*GetOptions) (
-	*minio.Object, error) {
+	obj Object, err error) {
 
 	// Set options
 	opt := m.getGetOptions(options...)
 
-	return m.con.GetObject(opt.Context, m.bucket, key,
+	obj, err = m.con.GetObject(opt.Context, m.bucket, m.key(key),
 		minio.GetObjectOptions(opt.GetObjectOptions))
+	if err != nil {
+		err = wrapError(err)
+		return
+	}
+
+	// The first Stat call sends request to S3 storage so getting object errors
+	// are returned here but not on first Read
+	if _, err = obj.Stat(); err != nil {
+		obj.Close()
+		obj, err = nil, wrapError(err)
+		return
+	}
+	if m.prefix != "" {
+		obj = &prefixObject{obj, m.prefix}
+	}
+	return
 }
 
 // GetInfo fetchs metadata of an object by key.
@@ -141,54 +278,83 @@ func (m *TeoS3) GetInfo(key string, options ...*GetInfoOptions) (
 	// Set options
 	opt := m.getGetInfoOptions(options...)
 
-	return m.con.StatObject(opt.Context, m.bucket, key,
+	info, err := m.con.StatObject(opt.Context, m.bucket, m.key(key),
 		minio.StatObjectOptions(opt.StatObjectOptions))
+	info.Key = strings.TrimPrefix(info.Key, m.prefix)
+	return info, wrapError(err)
 }
 
 // Del remove key from map by key. The options parameter may be omitted and than
 // default DelObjectOptions with context.Background and empty
-// minio.RemoveObjectOptions used.
+// minio.RemoveObjectOptions used. The folder key (ending with '/') is removed
+// with all its objects by RemoveObjects batches in opt.Workers concurrent
+// requests. The folder Del does not stop on objects errors and returns all of
+// them joined, the opt.Summary is set to the Del result if not nil.
 func (m *TeoS3) Del(key string, options ...*DelOptions) (err error) {
 
 	// Set options
 	opt := m.getDelOptions(options...)
+	sum := new(summary)
 
 	// Perform a recursive delete of a folder
-	_, err = m.foreach(opt.Context, key, func(key string) (err error) {
-		return m.Del(key, options...)
-	})
-	if err != nil {
-		return
+	if isFolder(key) {
+		return sum.result(opt.Summary, m.removeAll(key, opt, sum))
 	}
 
-	return m.con.RemoveObject(opt.Context, m.bucket, key,
+	info := m.summaryInfo(opt.Context, key, opt.Summary)
+	err = m.con.RemoveObject(opt.Context, m.bucket, m.key(key),
 		minio.RemoveObjectOptions(opt.DelObjectOptions))
+	if err = wrapError(err); err != nil {
+		sum.fail(key, err)
+	} else {
+		sum.done(info)
+	}
+	sum.result(opt.Summary, nil)
+
+	return
+}
+
+// removeAll removes all objects by prefix using RemoveObjects batches.
+func (m *TeoS3) removeAll(prefix string, opt *DelOptions,
+	sum *summary) (err error) {
+
+	r := m.newRemover(opt.Context, opt.Workers, minio.RemoveObjectsOptions{
+		GovernanceBypass: opt.GovernanceBypass,
+	}, sum.done, sum.fail)
+	_, err = m.walk(opt.Context, prefix, 1, r.add)
+	r.close()
+
+	return
 }
 
 // ListLen returns the number of records in the list by prefix and options.
 func (m *TeoS3) ListLen(prefix string, options ...*ListOptions) int {
+	l, _ := m.ListLenErr(prefix, options...)
+	return l
+}
+
+// ListLenErr returns the number of records in the list by prefix and options
+// and listing error. The number of records listed before error is returned
+// with error.
+func (m *TeoS3) ListLenErr(prefix string, options ...*ListOptions) (
+	l int, err error) {
 
 	// Get options from prefix and input options arguments
 	opt := m.getListOptions(prefix, options...)
 
-	objInfo := m.con.ListObjects(opt.Context, m.bucket,
-		minio.ListObjectsOptions(opt.ListObjectsOptions))
-
-	var i int
-	for range objInfo {
-		if opt.MaxKeys > 0 && i >= opt.MaxKeys {
-			break
-		}
-		i++
-	}
-	return i
+	err = m.listObjects(opt, func(obj minio.ObjectInfo) bool {
+		l++
+		return true
+	})
+	return
 }
 
 // List gets list of map keys by prefix. The options parameter may be omitted
 // and than default ListObjectsOptions with context.Background and empty
 // minio.ListObjectsOptions used. The Prefix parameter of the ListObjectsOptions
 // will be always overwritten with the prefix functions argument (so it may be
-// empty).
+// empty). Listing errors are skipped, use ListErr to get them. The keys
+// channel should be read to the end, use Keys iterator to stop listing early.
 func (m *TeoS3) List(prefix string, options ...*ListOptions) (keys chan string) {
 
 	// Get options from prefix and input options arguments
@@ -197,17 +363,41 @@ func (m *TeoS3) List(prefix string, options ...*ListOptions) (keys chan string)
 	// Get keys
 	keys = make(chan string, 1)
 	go func() {
-		var i int
+		m.listObjects(opt, func(obj minio.ObjectInfo) bool {
+			keys <- obj.Key
+			return true
+		})
+		close(keys)
+	}()
 
-		objInfo := m.con.ListObjects(opt.Context, m.bucket,
-			minio.ListObjectsOptions(opt.ListObjectsOptions))
+	return
+}
 
-		for obj := range objInfo {
-			if opt.MaxKeys > 0 && i >= opt.MaxKeys {
-				break
-			}
-			keys <- obj.Key
-			i++
+// ListResult is the ListErr channel value which contains key or listing
+// error.
+type ListResult struct {
+	Key string
+	Err error
+}
+
+// ListErr gets list of map keys by prefix the same as List does. Listing
+// error is sent to the channel in the ListResult Err field, the channel is
+// closed after error.
+func (m *TeoS3) ListErr(prefix string, options ...*ListOptions) (
+	keys chan ListResult) {
+
+	// Get options from prefix and input options arguments
+	opt := m.getListOptions(prefix, options...)
+
+	// Get keys
+	keys = make(chan ListResult, 1)
+	go func() {
+		err := m.listObjects(opt, func(obj minio.ObjectInfo) bool {
+			keys <- ListResult{Key: obj.Key}
+			return true
+		})
+		if err != nil {
+			keys <- ListResult{Err: err}
 		}
 		close(keys)
 	}()
@@ -219,47 +409,146 @@ func (m *TeoS3) List(prefix string, options ...*ListOptions) (keys chan string)
 func (m *TeoS3) ListAr(prefix string, options ...*ListOptions) (
 	list []string) {
 
+	list, _ = m.ListArErr(prefix, options...)
+	return
+}
+
+// ListArErr gets string array of map keys by prefix and listing error. Keys
+// listed before error are returned with error.
+func (m *TeoS3) ListArErr(prefix string, options ...*ListOptions) (
+	list []string, err error) {
+
 	// Get options from prefix and input options arguments
 	opt := m.getListOptions(prefix, options...)
 
-	objInfo := m.con.ListObjects(opt.Context, m.bucket,
-		minio.ListObjectsOptions(opt.ListObjectsOptions))
-
-	for obj := range objInfo {
+	err = m.listObjects(opt, func(obj minio.ObjectInfo) bool {
 		list = append(list, obj.Key)
-	}
-
+		return true
+	})
 	return
 }
 
 // ListBody gets all keys and values in MapData struct by prefix asynchronously.
+// Listing and getting errors are skipped, use ListBodyErr to get them. The
+// values are got concurrently by opt.Workers requests and are delivered in
+// keys order if opt.Ordered is set. The channel should be read to the end or
+// the options context should be canceled, use All iterator to stop listing
+// early without context.
 func (m *TeoS3) ListBody(prefix string, options ...*ListOptions) (
 	mapDataChan chan MapData) {
 
 	// Get options from prefix and input options arguments
 	opt := m.getListOptions(prefix, options...)
 
-	objInfo := m.con.ListObjects(opt.Context, m.bucket,
-		minio.ListObjectsOptions(opt.ListObjectsOptions))
+	mapDataErrChan := m.listBody(opt)
 
 	mapDataChan = make(chan MapData, 1)
 	go func() {
+		defer close(mapDataChan)
+		for mapData := range mapDataErrChan {
+			if mapData.Err != nil {
+				continue
+			}
+			select {
+			case mapDataChan <- mapData.MapData:
+			case <-opt.Context.Done():
+			}
+		}
+	}()
+
+	return
+}
+
+// MapDataResult is the ListBodyErr channel value which contains MapData or
+// error. The Key is set in error results if error occurs when getting value
+// of the key, and is empty if listing error occurs.
+type MapDataResult struct {
+	MapData
+	Err error
+}
+
+// ListBodyErr gets all keys and values by prefix asynchronously the same as
+// ListBody does. Listing and getting values errors are sent to the channel
+// in the MapDataResult Err field.
+func (m *TeoS3) ListBodyErr(prefix string, options ...*ListOptions) (
+	mapDataChan chan MapDataResult) {
+
+	// Get options from prefix and input options arguments
+	opt := m.getListOptions(prefix, options...)
+
+	return m.listBody(opt)
+}
+
+// listBody gets all keys and values by options asynchronously using
+// opt.Workers concurrent get requests. The results are sent in keys order if
+// opt.Ordered is set. The listing stops and results are dropped when the
+// options context is done.
+func (m *TeoS3) listBody(opt *ListOptions) (mapDataChan chan MapDataResult) {
+
+	mapDataChan = make(chan MapDataResult, 1)
+	send := func(mapData MapDataResult) {
+		select {
+		case mapDataChan <- mapData:
+		case <-opt.Context.Done():
+		}
+	}
+
+	go func() {
+		defer close(mapDataChan)
+
+		// Workers semaphore, the worker is released when its result sent
 		var wg sync.WaitGroup
+		workers := make(chan struct{}, opt.Workers)
+
+		// Send results in order of the results queue
+		var queue chan chan MapDataResult
+		if opt.Ordered {
+			queue = make(chan chan MapDataResult, opt.Workers)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for result := range queue {
+					send(<-result)
+					<-workers
+				}
+			}()
+		}
+
+		err := m.listObjects(opt, func(obj minio.ObjectInfo) bool {
+			select {
+			case workers <- struct{}{}:
+			case <-opt.Context.Done():
+				return false
+			}
+
+			result := make(chan MapDataResult, 1)
+			if opt.Ordered {
+				queue <- result
+			}
 
-		for obj := range objInfo {
 			wg.Add(1)
 			go func(obj minio.ObjectInfo) {
 				defer wg.Done()
-				data, err := m.Get(obj.Key)
-				if err != nil {
+				data, err := m.Get(obj.Key, &GetOptions{Context: opt.Context})
+				mapData := MapDataResult{MapData{obj.Key, data}, err}
+				if opt.Ordered {
+					result <- mapData
 					return
 				}
-				mapDataChan <- MapData{obj.Key, data}
+				send(mapData)
+				<-workers
 			}(obj)
-		}
+			return true
+		})
 
+		// Wait all results and send listing error
+		if opt.Ordered {
+			close(queue)
+		}
 		wg.Wait()
-		close(mapDataChan)
+		if err != nil {
+			send(MapDataResult{Err: err})
+		}
 	}()
 
 	return
@@ -269,11 +558,25 @@ func (m *TeoS3) ListBody(prefix string, options ...*ListOptions) (
 func (m *TeoS3) ListBodyAr(prefix string, options ...*ListOptions) (
 	listBody []MapData) {
 
-	mapDataChan := m.ListBody(prefix, options...)
+	listBody, _ = m.ListBodyArErr(prefix, options...)
+	return
+}
 
-	for mapData := range mapDataChan {
-		listBody = append(listBody, mapData)
+// ListBodyArErr gets MapData array with all keys and values by prefix and
+// errors. Keys and values got without errors are returned with error which
+// joins all listing and getting values errors.
+func (m *TeoS3) ListBodyArErr(prefix string, options ...*ListOptions) (
+	listBody []MapData, err error) {
+
+	var errs []error
+	for mapData := range m.ListBodyErr(prefix, options...) {
+		if mapData.Err != nil {
+			errs = append(errs, mapData.Err)
+			continue
+		}
+		listBody = append(listBody, mapData.MapData)
 	}
+	err = errors.Join(errs...)
 
 	return
 }
@@ -281,107 +584,430 @@ func (m *TeoS3) ListBodyAr(prefix string, options ...*ListOptions) (
 // Copy copys source object to destination object
 func (m *TeoS3) Copy(source, destination string, options ...*CopyOptions) (
 	err error) {
+	return m.CopyTo(m, source, destination, options...)
+}
+
+// CopyTo copys source object or folder of m to destination object or folder
+// of dst. The dst may be view of another bucket of m connection (see
+// WithBucket and WithPrefix) or another connection. Objects are copied on
+// server side if m and dst use the same connection, otherwise objects are
+// streamed from m to dst. The folder is merged into existing destination
+// folder and the opt.Overwrite mode is applied to each copied object. The
+// destination object is written with If-Match or If-None-Match precondition,
+// so the overwrite mode check is atomic if S3 storage supports conditional
+// requests.
+//
+//	archive := con.WithBucket("archive")
+//	err := con.CopyTo(archive, "reports/", "2023/reports/",
+//		&teos3.CopyOptions{Overwrite: teos3.OverwriteIfNewer})
+func (m *TeoS3) CopyTo(dst *TeoS3, source, destination string,
+	options ...*CopyOptions) (err error) {
+
+	// Get options from input options arguments
+	opt := m.getCopyOptions(options...)
+
+	return m.copyTo(dst, source, destination, opt, false)
+}
+
+// Move movess source object to destination object
+func (m *TeoS3) Move(source, destination string, options ...*CopyOptions) (
+	err error) {
+	return m.MoveTo(m, source, destination, options...)
+}
+
+// MoveTo movess source object or folder of m to destination object or folder
+// of dst. The source objects are copied the same as CopyTo does and removed
+// after copy. The source objects skipped by opt.Overwrite mode are not
+// removed.
+func (m *TeoS3) MoveTo(dst *TeoS3, source, destination string,
+	options ...*CopyOptions) (err error) {
+
+	// Get options from input options arguments
+	opt := m.getCopyOptions(options...)
+
+	return m.copyTo(dst, source, destination, opt, true)
+}
+
+// copyTo copys source object or folder of m to destination object or folder
+// of dst and removes copied source objects if move is true. The folder
+// objects are copied in opt.Workers concurrent requests, the objects errors
+// are joined and returned after all objects processed.
+func (m *TeoS3) copyTo(dst *TeoS3, source, destination string,
+	opt *CopyOptions, move bool) (err error) {
 
-	// Get context from options argument
-	context := m.context
-	if len(options) > 0 {
-		context = options[0].Context
+	sum := new(summary)
+
+	// Remove moved source objects by RemoveObjects batches
+	var r *remover
+	if move {
+		r = m.newRemover(opt.Context, opt.Workers,
+			minio.RemoveObjectsOptions{}, nil, sum.fail)
 	}
 
-	// Check if destination does not exist
-	if _, e := m.GetInfo(destination, &GetInfoOptions{Context: context}); e == nil {
-		err = ErrDestinationObjectAlreadyExists
+	// Copy object and add it to summary
+	copyOne := func(obj minio.ObjectInfo) (err error) {
+		name := strings.TrimPrefix(obj.Key, source)
+		copied, err := m.copyObject(dst, obj, destination+name, opt)
+		switch {
+		case err != nil:
+			sum.fail(obj.Key, err)
+		case !copied:
+			sum.skip()
+		default:
+			sum.done(obj)
+			if move {
+				r.add(obj)
+			}
+		}
 		return
 	}
 
 	// Recursive copy
-	done, err := m.foreach(context, source, func(key string) (err error) {
-		name := m.fileBase(key)
-		return m.Copy(source+name, destination+name, options...)
-	})
-	if err != nil || done {
-		return
+	var listed bool
+	if isFolder(source) {
+		listed, err = m.walk(opt.Context, source, opt.Workers,
+			func(obj minio.ObjectInfo) { copyOne(obj) })
+	}
+
+	// Copy object or empty folder
+	var objErr error
+	if !listed && err == nil {
+		objErr = copyOne(m.summaryInfo(opt.Context, source, opt.Summary))
+	}
+
+	if move {
+		r.close()
+	}
+	err = sum.result(opt.Summary, err)
+	if objErr != nil {
+		err = objErr
+	}
+
+	return
+}
+
+// copyObject copys source object of m to destination object of dst using
+// opt.Overwrite mode. The source size is -1 if it is unknown. The copied is
+// false if the existing destination object was skipped.
+func (m *TeoS3) copyObject(dst *TeoS3, src minio.ObjectInfo,
+	destination string, opt *CopyOptions) (copied bool, err error) {
+
+	source := src.Key
+
+	// Check source preconditions before destination, so the destination
+	// precondition failure may be recognized
+	if opt.sourcePreconditions() {
+		var info minio.ObjectInfo
+		info, err = m.GetInfo(source, &GetInfoOptions{Context: opt.Context})
+		if err != nil {
+			return
+		}
+		err = checkCopySource(opt.copySource(m.bucket, m.key(source)), info)
+		if err != nil {
+			err = wrapError(err)
+			return
+		}
+	}
+
+	// Check destination object and set destination preconditions
+	var cond precondition
+	if opt.Overwrite != OverwriteAlways || isFolder(destination) {
+		var info minio.ObjectInfo
+		info, err = dst.GetInfo(destination,
+			&GetInfoOptions{Context: opt.Context})
+		switch {
+		case errors.Is(err, ErrNotFound):
+			cond.ifNoneMatch, err = "*", nil
+		case err != nil:
+			return
+		case isFolder(destination):
+			// Existing destination folder is merged
+			copied = true
+			return
+		default:
+			copied, err = m.overwrite(source, info, opt)
+			if err != nil || !copied {
+				return
+			}
+			cond.ifMatch = info.ETag
+		}
 	}
 
 	// If destination is a folder than create new destination folder instead of
 	// copy source folder to destination because there is empty folder (all
 	// folder was processed in Recursive copy above) and CopyObject wiil return
 	// an error for copy folder
-	if m.isFolder(destination) {
-		return m.Set(destination, nil)
+	switch {
+	case isFolder(destination):
+		err = dst.Set(destination, nil, &SetOptions{
+			Context:          opt.Context,
+			SetObjectOptions: cond.setObjectOptions(SetObjectOptions{}),
+		})
+
+	// Stream object if server side copy is impossible
+	case !m.sameBackend(dst):
+		err = m.streamTo(dst, source, destination, opt, cond)
+
+	// Copy source object to destination object on server side
+	default:
+		err = m.serverCopy(dst, src, destination, opt, cond)
 	}
 
-	// Create copy source option
-	src := minio.CopySrcOptions{
-		Bucket: m.bucket,
-		Object: source,
+	// Check concurrently created destination object
+	if cond.ifNoneMatch != "" && !opt.sourcePreconditions() &&
+		errors.Is(err, ErrPreconditionFailed) {
+		switch {
+		case isFolder(destination):
+			err = nil
+		case opt.Overwrite == OverwriteSkip:
+			return false, nil
+		case opt.Overwrite == OverwriteFail:
+			err = ErrDestinationObjectAlreadyExists
+		}
+	}
+	copied = err == nil
+
+	return
+}
+
+// overwrite returns true if existing destination object with info should be
+// overwritten with source object by opt.Overwrite mode. The
+// ErrDestinationObjectAlreadyExists is returned in OverwriteFail mode.
+func (m *TeoS3) overwrite(source string, info minio.ObjectInfo,
+	opt *CopyOptions) (ok bool, err error) {
+
+	switch opt.Overwrite {
+	case OverwriteAlways:
+		ok = true
+	case OverwriteFail:
+		err = ErrDestinationObjectAlreadyExists
+	case OverwriteSkip:
+	case OverwriteIfNewer, OverwriteIfDifferent:
+		var srcInfo minio.ObjectInfo
+		srcInfo, err = m.GetInfo(source, &GetInfoOptions{Context: opt.Context})
+		if err != nil {
+			return
+		}
+		if opt.Overwrite == OverwriteIfNewer {
+			ok = srcInfo.LastModified.After(info.LastModified)
+		} else {
+			ok = !sameContent(srcInfo, info)
+		}
+	default:
+		err = fmt.Errorf("wrong overwrite mode %d", opt.Overwrite)
+	}
+	return
+}
+
+// sameContent returns true if objects a and b have the same content. The
+// objects with single part ETags are compared by size and ETag. The
+// multipart ETag depends on part size, so if one of objects has multipart
+// ETag the objects are compared by size and checksum stored in metadata.
+func sameContent(a, b minio.ObjectInfo) bool {
+	switch {
+	case a.Size != b.Size:
+		return false
+	case !isMultipartETag(a.ETag) && !isMultipartETag(b.ETag):
+		return strings.Trim(a.ETag, `"`) == strings.Trim(b.ETag, `"`)
 	}
+	sum := objectChecksum(a)
+	return sum != "" && strings.EqualFold(sum, objectChecksum(b))
+}
+
+// isMultipartETag returns true if etag is ETag of multipart upload: MD5 of
+// parts MD5 with '-' and parts number suffix.
+func isMultipartETag(etag string) bool {
+	return strings.Contains(etag, "-")
+}
+
+// serverCopy copys source object of m to destination object of dst on
+// server side. The destination preconditions are checked by backend if it
+// implements ConditionalCopier. The source objects larger than 5 GiB are
+// copied by parts if backend implements Composer, the ComposeObject does not
+// check destination preconditions so they are checked by destination object
+// info request before copy.
+func (m *TeoS3) serverCopy(dst *TeoS3, info minio.ObjectInfo,
+	destination string, opt *CopyOptions, cond precondition) (err error) {
+
+	// Create copy source option
+	src := opt.copySource(m.bucket, m.key(info.Key))
 
 	// Create copy destination option
-	dst := minio.CopyDestOptions{
-		Bucket: m.bucket,
-		Object: destination,
+	dstOpt := minio.CopyDestOptions{
+		Bucket:      dst.bucket,
+		Object:      dst.key(destination),
+		ReplaceTags: opt.ReplaceTags,
+		UserTags:    opt.UserTags,
+	}
+
+	// Get source object info if destination metadata is changed, object is
+	// copied onto itself or its size is unknown
+	self := src.Bucket == dstOpt.Bucket && src.Object == dstOpt.Object
+	composer, ok := m.con.(Composer)
+	if opt.replaceMetadata() || self ||
+		ok && (info.Size < 0 || info.Size >= composeObjectSize) {
+		info, err = m.GetInfo(info.Key, &GetInfoOptions{Context: opt.Context})
+		if err != nil {
+			return
+		}
+	}
+	large := ok && info.Size >= composeObjectSize
+
+	// Set destination object metadata, the metadata should be replaced if
+	// object is copied onto itself and it is always set by ComposeObject
+	if opt.replaceMetadata() || self || large {
+		setCopyMetadata(&dstOpt, opt.objectOptions(info))
+	}
+
+	// Copy large source object by parts
+	if large {
+		if err = dst.checkPrecondition(opt.Context, destination,
+			cond); err != nil {
+			return
+		}
+		dstOpt.PartSize = copyPartSize
+		_, err = composer.ComposeObject(opt.Context, dstOpt, src)
+		return wrapError(err)
 	}
 
 	// Copy source object to destination object
-	_, err = m.con.CopyObject(context, dst, src)
-	fmt.Println("copy", dst, src, err)
+	if copier, ok := m.con.(ConditionalCopier); ok {
+		_, err = copier.CopyObjectIf(opt.Context, dstOpt, src, cond.ifMatch,
+			cond.ifNoneMatch)
+	} else {
+		_, err = m.con.CopyObject(opt.Context, dstOpt, src)
+	}
+	err = wrapError(err)
 
 	return
 }
 
-// Move movess source object to destination object
-func (m *TeoS3) Move(source, destination string, options ...*CopyOptions) (
-	err error) {
+// checkPrecondition returns ErrPreconditionFailed if object by key does not
+// match preconditions.
+func (m *TeoS3) checkPrecondition(ctx context.Context, key string,
+	cond precondition) (err error) {
 
-	// Copy source object to destination object
-	if err = m.Copy(source, destination, options...); err != nil {
+	if cond == (precondition{}) {
+		return
+	}
+	var info *minio.ObjectInfo
+	objInfo, err := m.GetInfo(key, &GetInfoOptions{Context: ctx})
+	switch {
+	case err == nil:
+		info = &objInfo
+	case !errors.Is(err, ErrNotFound):
 		return
 	}
+	return wrapError(cond.check(m.bucket, m.key(key), info))
+}
 
-	// Get context from options arguments
-	context := m.context
-	if len(options) > 0 {
-		context = options[0].Context
+// setCopyMetadata sets user metadata, content type and storage class of
+// object options to copy destination options which replace destination
+// object metadata.
+func setCopyMetadata(dst *minio.CopyDestOptions, opts SetObjectOptions) {
+	dst.ReplaceMetadata = true
+	dst.UserMetadata = make(map[string]string, len(opts.UserMetadata)+2)
+	for k, v := range opts.UserMetadata {
+		dst.UserMetadata[k] = v
+	}
+	if opts.ContentType != "" {
+		dst.UserMetadata["Content-Type"] = opts.ContentType
 	}
+	if opts.StorageClass != "" {
+		dst.UserMetadata["X-Amz-Storage-Class"] = opts.StorageClass
+	}
+}
 
-	// Delete source object
-	err = m.Del(source, &DelOptions{Context: context})
+// streamTo copys source object of m to destination object of dst by reading
+// source object and writing it to destination with preconditions. The object
+// content type, metadata, tags and storage class are copied or replaced by
+// copy options.
+func (m *TeoS3) streamTo(dst *TeoS3, source, destination string,
+	opt *CopyOptions, cond precondition) (err error) {
 
-	return
+	obj, err := m.GetObject(source, &GetOptions{Context: opt.Context})
+	if err != nil {
+		return
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		return wrapError(err)
+	}
+
+	// Check source preconditions
+	err = checkCopySource(opt.copySource(m.bucket, m.key(source)), info)
+	if err != nil {
+		return wrapError(err)
+	}
+
+	return dst.SetObject(destination, obj, info.Size, &SetOptions{
+		Context:          opt.Context,
+		SetObjectOptions: cond.setObjectOptions(opt.objectOptions(info)),
+	})
 }
 
-// foreach calls callback function for all keys in folder key. The foreach
-// returns done = true if at list one callback function was processed.
-func (m *TeoS3) foreach(context context.Context, key string,
-	calback func(key string) error) (done bool, err error) {
+// sameBackend returns true if m and dst use the same backend, so objects
+// may be copied between them on server side.
+func (m *TeoS3) sameBackend(dst *TeoS3) bool {
+	if !reflect.TypeOf(m.con).Comparable() {
+		return false
+	}
+	return m.con == dst.con
+}
 
-	if m.isFolder(key) {
-		for k := range m.List(key, &ListOptions{Context: context}) {
-			if k == key {
-				continue
-			}
-			done = true
-			if err = calback(k); err != nil {
-				return
-			}
+// listObjects calls callback function for each object listed by options
+// until callback returns false or opt.MaxKeys objects are listed. The listing
+// error is returned.
+func (m *TeoS3) listObjects(opt *ListOptions,
+	callback func(obj minio.ObjectInfo) bool) (err error) {
+
+	// Add prefix to list options
+	listOpt := minio.ListObjectsOptions(opt.ListObjectsOptions)
+	listOpt.Prefix = m.key(listOpt.Prefix)
+	if listOpt.StartAfter != "" {
+		listOpt.StartAfter = m.key(listOpt.StartAfter)
+	}
+
+	ctx, cancel := context.WithCancel(opt.Context)
+	objInfo := m.con.ListObjects(ctx, m.bucket, listOpt)
+
+	// Stop listing and drain objects channel when this function returns
+	defer func() {
+		cancel()
+		for range objInfo {
+		}
+	}()
+
+	var i int
+	for obj := range objInfo {
+		if obj.Err != nil {
+			return wrapError(obj.Err)
 		}
+		obj.Key = strings.TrimPrefix(obj.Key, m.prefix)
+		if opt.MaxKeys > 0 && i >= opt.MaxKeys || !callback(obj) {
+			return
+		}
+		i++
 	}
 
 	return
 }
 
-// Base returns the last element of path including trailing slash.
-func (m *TeoS3) fileBase(key string) (base string) {
-	base = filepath.Base(key)
-	if m.isFolder(key) {
-		base += "/"
-	}
-	return base
+// key returns object name of key with TeoS3 prefix.
+func (m *TeoS3) key(key string) string { return m.prefix + key }
+
+// prefixObject is the Object of TeoS3 prefix view. Its Stat returns info with
+// key without prefix.
+type prefixObject struct {
+	Object
+	prefix string
 }
 
-// isFolder returns true if key is a folder
-func (m *TeoS3) isFolder(key string) bool {
-	l := len(key)
-	return l > 0 && key[l-1] == '/'
+// Stat returns object info with key without prefix.
+func (o *prefixObject) Stat() (info minio.ObjectInfo, err error) {
+	info, err = o.Object.Stat()
+	info.Key = strings.TrimPrefix(info.Key, o.prefix)
+	return
 }
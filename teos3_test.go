@@ -0,0 +1,909 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/teonet-go/teos3"
+	"github.com/teonet-go/teos3/teos3test"
+)
+
+func TestMain(m *testing.M) {
+	// The copy functions log errors which are expected in tests
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// connections returns connections to in-memory backend, local file system
+// backend and to test S3 server by backend name. The backends of all
+// connections are wrapped by wrap function if it is not nil.
+func connections(t *testing.T,
+	wrap func(name string, b teos3.Backend) teos3.Backend) (
+	cons map[string]*teos3.TeoS3) {
+
+	t.Helper()
+	if wrap == nil {
+		wrap = func(name string, b teos3.Backend) teos3.Backend { return b }
+	}
+
+	srv := teos3test.NewServerBackend(wrap("server", teos3.NewMemory()))
+	t.Cleanup(srv.Close)
+	con, err := srv.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fs, err := teos3.NewFileSystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]*teos3.TeoS3{
+		"memory":     teos3.ConnectBackend(wrap("memory", teos3.NewMemory())),
+		"filesystem": teos3.ConnectBackend(wrap("filesystem", fs)),
+		"server":     con,
+	}
+}
+
+// get returns object data by key or fails test.
+func get(t *testing.T, con *teos3.TeoS3, key string) []byte {
+	t.Helper()
+
+	data, err := con.Get(key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	return data
+}
+
+// set sets objects data by keys or fails test.
+func set(t *testing.T, con *teos3.TeoS3, keys ...string) {
+	t.Helper()
+
+	for _, key := range keys {
+		if err := con.Set(key, []byte(key)); err != nil {
+			t.Fatalf("set %s: %v", key, err)
+		}
+	}
+}
+
+func TestViews(t *testing.T) {
+	tests := []struct {
+		name   string
+		view   func(con *teos3.TeoS3) *teos3.TeoS3
+		bucket string // view bucket, empty for connection bucket
+		prefix string // view keys prefix
+	}{
+		{"prefix", func(con *teos3.TeoS3) *teos3.TeoS3 {
+			return con.WithPrefix("a/")
+		}, "", "a/"},
+		{"nested prefix", func(con *teos3.TeoS3) *teos3.TeoS3 {
+			return con.WithPrefix("b/").WithPrefix("c/")
+		}, "", "b/c/"},
+		{"bucket", func(con *teos3.TeoS3) *teos3.TeoS3 {
+			return con.WithBucket("other")
+		}, "other", ""},
+		{"bucket prefix", func(con *teos3.TeoS3) *teos3.TeoS3 {
+			return con.WithPrefix("d/").WithBucket("other")
+		}, "other", "d/"},
+	}
+
+	for backend, con := range connections(t, nil) {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				view := tt.view(con)
+				raw := con
+				if tt.bucket != "" {
+					raw = con.WithBucket(tt.bucket)
+				}
+				if view.Prefix() != tt.prefix {
+					t.Fatalf("got prefix %q, want %q", view.Prefix(),
+						tt.prefix)
+				}
+
+				// The view key is saved with prefix
+				set(t, view, "key")
+				if data := get(t, raw, tt.prefix+"key"); string(data) !=
+					"key" {
+					t.Fatalf("got %q, want %q", data, "key")
+				}
+				if tt.bucket != "" {
+					_, err := con.GetInfo(tt.prefix + "key")
+					if !errors.Is(err, teos3.ErrNotFound) {
+						t.Fatalf("got error %v, want %v", err,
+							teos3.ErrNotFound)
+					}
+				}
+
+				// The view results contain keys without prefix
+				info, err := view.GetInfo("key")
+				switch {
+				case err != nil:
+					t.Fatal(err)
+				case info.Key != "key":
+					t.Fatalf("got GetInfo key %s, want key", info.Key)
+				}
+				obj, err := view.GetObject("key")
+				if err != nil {
+					t.Fatal(err)
+				}
+				info, err = obj.Stat()
+				obj.Close()
+				switch {
+				case err != nil:
+					t.Fatal(err)
+				case info.Key != "key":
+					t.Fatalf("got object key %s, want key", info.Key)
+				}
+				keys, err := view.ListArErr("")
+				switch {
+				case err != nil:
+					t.Fatal(err)
+				case !slices.Equal(keys, []string{"key"}):
+					t.Fatalf("got keys %v, want [key]", keys)
+				}
+				for mapData := range view.ListBody("") {
+					if mapData.Key != "key" {
+						t.Fatalf("got ListBody key %s, want key",
+							mapData.Key)
+					}
+				}
+
+				// The view key is removed with prefix
+				if err := view.Del("key"); err != nil {
+					t.Fatal(err)
+				}
+				_, err = raw.GetInfo(tt.prefix + "key")
+				if !errors.Is(err, teos3.ErrNotFound) {
+					t.Fatalf("got error %v, want %v", err, teos3.ErrNotFound)
+				}
+			})
+		}
+	}
+}
+
+// errList is the listing error of failingList backend, the test server
+// returns it to client as is.
+var errList = minio.ErrorResponse{StatusCode: http.StatusForbidden,
+	Code: "AccessDenied", Message: "List failed."}
+
+// failingList is backend which fails listing after first two objects.
+type failingList struct{ teos3.Backend }
+
+func (b failingList) ListObjects(ctx context.Context, bucket string,
+	opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+
+	ch := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(ch)
+		var n int
+		for info := range b.Backend.ListObjects(ctx, bucket, opts) {
+			if n++; n > 2 {
+				info = minio.ObjectInfo{Err: errList}
+			}
+			ch <- info
+			if info.Err != nil {
+				break
+			}
+		}
+	}()
+	return ch
+}
+
+func TestListErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		list func(con *teos3.TeoS3) (n int, err error)
+	}{
+		{"ListErr", func(con *teos3.TeoS3) (n int, err error) {
+			for r := range con.ListErr("") {
+				if r.Err != nil {
+					err = r.Err
+					continue
+				}
+				n++
+			}
+			return
+		}},
+		{"ListArErr", func(con *teos3.TeoS3) (n int, err error) {
+			keys, err := con.ListArErr("")
+			return len(keys), err
+		}},
+		{"ListLenErr", func(con *teos3.TeoS3) (n int, err error) {
+			return con.ListLenErr("")
+		}},
+		{"ListBodyErr", func(con *teos3.TeoS3) (n int, err error) {
+			for r := range con.ListBodyErr("") {
+				if r.Err != nil {
+					err = r.Err
+					continue
+				}
+				n++
+			}
+			return
+		}},
+		{"ListBodyArErr", func(con *teos3.TeoS3) (n int, err error) {
+			list, err := con.ListBodyArErr("")
+			return len(list), err
+		}},
+		{"Keys", func(con *teos3.TeoS3) (n int, err error) {
+			for _, e := range con.Keys("") {
+				if e != nil {
+					err = e
+					continue
+				}
+				n++
+			}
+			return
+		}},
+	}
+
+	// The local backends error is returned after listed keys, the server
+	// fails whole list page
+	want := map[string]int{"memory": 2, "filesystem": 2, "server": 0}
+
+	wrap := func(name string, b teos3.Backend) teos3.Backend {
+		return failingList{b}
+	}
+	for backend, con := range connections(t, wrap) {
+		set(t, con, "a", "b", "c", "d")
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				n, err := tt.list(con)
+				switch {
+				case err == nil:
+					t.Fatal("listing error is not returned")
+				case !errors.Is(err, teos3.ErrAccessDenied):
+					t.Fatalf("got error %v, want %v", err,
+						teos3.ErrAccessDenied)
+				case n != want[backend]:
+					t.Fatalf("got %d keys before error, want %d", n,
+						want[backend])
+				}
+			})
+		}
+	}
+
+	// The errors are skipped by list functions without error
+	for backend, con := range connections(t, wrap) {
+		set(t, con, "a", "b", "c", "d")
+		if n := con.ListLen(""); n != want[backend] {
+			t.Fatalf("%s: got ListLen %d, want %d", backend, n, want[backend])
+		}
+	}
+}
+
+// countingGet is backend which counts concurrent GetObject requests. The
+// objects with lower key numbers are got longer, so the concurrent requests
+// are completed out of keys order.
+type countingGet struct {
+	teos3.Backend
+	mut    sync.Mutex
+	active int
+	max    int
+}
+
+func (b *countingGet) GetObject(ctx context.Context, bucket, key string,
+	opts minio.GetObjectOptions) (teos3.Object, error) {
+
+	b.mut.Lock()
+	b.active++
+	b.max = max(b.max, b.active)
+	b.mut.Unlock()
+	defer func() {
+		b.mut.Lock()
+		b.active--
+		b.mut.Unlock()
+	}()
+
+	var i int
+	fmt.Sscanf(path.Base(key), "key%d", &i)
+	time.Sleep(time.Duration(20-i) * 200 * time.Microsecond)
+
+	return b.Backend.GetObject(ctx, bucket, key, opts)
+}
+
+func TestListBodyWorkers(t *testing.T) {
+	tests := []struct {
+		workers int
+		ordered bool
+	}{
+		{1, false}, {1, true}, {4, false}, {4, true},
+	}
+
+	for _, tt := range tests {
+		counters := make(map[string]*countingGet)
+		wrap := func(name string, b teos3.Backend) teos3.Backend {
+			counters[name] = &countingGet{Backend: b}
+			return counters[name]
+		}
+		for backend, con := range connections(t, wrap) {
+			name := fmt.Sprintf("%s/workers=%d/ordered=%v", backend,
+				tt.workers, tt.ordered)
+			t.Run(name, func(t *testing.T) {
+				var keys []string
+				for i := range 20 {
+					keys = append(keys, fmt.Sprintf("key%02d", i))
+				}
+				set(t, con, keys...)
+
+				opt := con.NewListOptions().SetWorkers(tt.workers).
+					SetOrdered(tt.ordered)
+				var got []string
+				for mapData := range con.ListBody("", opt) {
+					got = append(got, mapData.Key)
+				}
+				if !tt.ordered {
+					slices.Sort(got)
+				}
+				if !slices.Equal(got, keys) {
+					t.Fatalf("got keys %v, want %v", got, keys)
+				}
+				if n := counters[backend].max; n > tt.workers {
+					t.Fatalf("got %d concurrent requests, want at most %d",
+						n, tt.workers)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyToOverwrite(t *testing.T) {
+	tests := []struct {
+		name      string
+		overwrite teos3.Overwrite
+		existing  string // Existing target data, target does not exist if empty
+		newer     bool   // Target is modified after source
+		match     func(etag string) *teos3.CopyOptions
+		want      string // Target data after copy
+		err       error
+	}{
+		{name: "fail new", overwrite: teos3.OverwriteFail,
+			want: "source"},
+		{name: "fail existing", overwrite: teos3.OverwriteFail,
+			existing: "target", want: "target",
+			err: teos3.ErrDestinationObjectAlreadyExists},
+		{name: "always", overwrite: teos3.OverwriteAlways,
+			existing: "target", want: "source"},
+		{name: "skip new", overwrite: teos3.OverwriteSkip,
+			want: "source"},
+		{name: "skip existing", overwrite: teos3.OverwriteSkip,
+			existing: "target", want: "target"},
+		{name: "if newer older", overwrite: teos3.OverwriteIfNewer,
+			existing: "target", newer: true, want: "target"},
+		{name: "if newer newer", overwrite: teos3.OverwriteIfNewer,
+			existing: "target", want: "source"},
+		{name: "if different same", overwrite: teos3.OverwriteIfDifferent,
+			existing: "source", want: "source"},
+		{name: "if different", overwrite: teos3.OverwriteIfDifferent,
+			existing: "target", want: "source"},
+		{name: "match etag", overwrite: teos3.OverwriteAlways,
+			existing: "target", want: "source",
+			match: func(etag string) *teos3.CopyOptions {
+				return &teos3.CopyOptions{MatchETag: etag}
+			}},
+		{name: "match etag failed", overwrite: teos3.OverwriteAlways,
+			existing: "target", want: "target",
+			err: teos3.ErrPreconditionFailed,
+			match: func(etag string) *teos3.CopyOptions {
+				return &teos3.CopyOptions{MatchETag: "0123456789abcdef"}
+			}},
+		{name: "no match etag failed", overwrite: teos3.OverwriteAlways,
+			existing: "target", want: "target",
+			err: teos3.ErrPreconditionFailed,
+			match: func(etag string) *teos3.CopyOptions {
+				return &teos3.CopyOptions{NoMatchETag: etag}
+			}},
+	}
+
+	// The objects are copied in bucket of the same connection on server
+	// side and streamed to another connection
+	type run struct {
+		name        string
+		test        int
+		con, dstCon *teos3.TeoS3
+		move        bool
+	}
+	var runs []run
+	for backend, con := range connections(t, nil) {
+		targets := map[string]*teos3.TeoS3{
+			"bucket":     con.WithBucket("target"),
+			"connection": teos3.ConnectMemory(),
+		}
+		for target, dstCon := range targets {
+			for _, move := range []string{"copy", "move"} {
+				for i, tt := range tests {
+					key := fmt.Sprintf("%s/%s/%d/", target, move, i)
+					runs = append(runs, run{fmt.Sprintf("%s/%s/%s %s",
+						backend, target, move, tt.name), i,
+						con.WithPrefix(key), dstCon.WithPrefix(key),
+						move == "move"})
+				}
+			}
+		}
+	}
+
+	// Create 'source' and 'target' objects, the newer objects are created
+	// after second as S3 modification time has seconds precision
+	for _, newer := range []bool{false, true} {
+		if newer {
+			time.Sleep(time.Second)
+		}
+		for _, r := range runs {
+			tt := tests[r.test]
+			if tt.existing != "" && tt.newer == newer {
+				err := r.dstCon.Set("target", []byte(tt.existing))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.newer != newer {
+				set(t, r.con, "source")
+			}
+		}
+	}
+
+	for _, r := range runs {
+		tt := tests[r.test]
+		t.Run(r.name, func(t *testing.T) {
+			const src, dst = "source", "target"
+
+			opt := &teos3.CopyOptions{}
+			if tt.match != nil {
+				info, err := r.con.GetInfo(src)
+				if err != nil {
+					t.Fatal(err)
+				}
+				opt = tt.match(info.ETag)
+			}
+			opt.Overwrite = tt.overwrite
+			var sum teos3.Summary
+			opt.Summary = &sum
+
+			copyTo := r.con.CopyTo
+			if r.move {
+				copyTo = r.con.MoveTo
+			}
+			err := copyTo(r.dstCon, src, dst, opt)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+
+			if got := string(get(t, r.dstCon, dst)); got != tt.want {
+				t.Fatalf("got target %q, want %q", got, tt.want)
+			}
+			copied := tt.err == nil && (tt.existing == "" ||
+				tt.want == src && tt.existing != src)
+			switch {
+			case copied && (sum.Objects != 1 || sum.Skipped != 0):
+				t.Fatalf("got summary %+v, want one copied object", sum)
+			case !copied && tt.err == nil && sum.Skipped != 1:
+				t.Fatalf("got summary %+v, want one skipped object", sum)
+			}
+
+			// The moved source is removed, failed and skipped sources are
+			// kept
+			_, err = r.con.GetInfo(src)
+			removed := errors.Is(err, teos3.ErrNotFound)
+			if removed != (r.move && copied) {
+				t.Fatalf("source removed %v, want %v", removed,
+					r.move && copied)
+			}
+		})
+	}
+}
+
+// racingComposer is Composer backend which records ComposeObject calls and
+// writes 'concurrent' target object after the first target object info
+// request if race is set.
+type racingComposer struct {
+	teos3.Backend
+	race     atomic.Bool
+	composed atomic.Int32
+}
+
+func (b *racingComposer) StatObject(ctx context.Context, bucket, key string,
+	opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+
+	info, err := b.Backend.StatObject(ctx, bucket, key, opts)
+	if path.Base(key) == "target" && b.race.CompareAndSwap(true, false) {
+		_, e := b.Backend.PutObject(ctx, bucket, key,
+			strings.NewReader("concurrent"), 10, minio.PutObjectOptions{})
+		if e != nil {
+			return info, e
+		}
+	}
+	return info, err
+}
+
+func (b *racingComposer) ComposeObject(ctx context.Context,
+	dst minio.CopyDestOptions, srcs ...minio.CopySrcOptions) (
+	minio.UploadInfo, error) {
+
+	b.composed.Add(1)
+	return b.Backend.CopyObject(ctx, dst, srcs[0])
+}
+
+func TestCopyToCompose(t *testing.T) {
+	defer teos3.SetComposeObjectSize(1)()
+
+	tests := []struct {
+		name      string
+		overwrite teos3.Overwrite
+		existing  bool // target exists
+		race      bool // target is written after its info request
+		want      string
+		err       error
+	}{
+		{name: "new", overwrite: teos3.OverwriteFail, want: "source"},
+		{name: "existing", overwrite: teos3.OverwriteIfDifferent,
+			existing: true, want: "source"},
+		{name: "created", overwrite: teos3.OverwriteFail, race: true,
+			want: "concurrent", err: teos3.ErrDestinationObjectAlreadyExists},
+		{name: "changed", overwrite: teos3.OverwriteIfDifferent,
+			existing: true, race: true, want: "concurrent",
+			err: teos3.ErrPreconditionFailed},
+	}
+
+	composers := make(map[string]*racingComposer)
+	wrap := func(name string, b teos3.Backend) teos3.Backend {
+		composers[name] = &racingComposer{Backend: b}
+		return composers[name]
+	}
+	for backend, con := range connections(t, wrap) {
+		for i, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				con := con.WithPrefix(fmt.Sprintf("%d/", i))
+				composer := composers[backend]
+				set(t, con, "source")
+				if tt.existing {
+					if err := con.Set("target", []byte("old")); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				composer.race.Store(tt.race)
+				composed := composer.composed.Load()
+				err := con.Copy("source", "target",
+					&teos3.CopyOptions{Overwrite: tt.overwrite})
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("got error %v, want %v", err, tt.err)
+				}
+				if got := string(get(t, con, "target")); got != tt.want {
+					t.Fatalf("got target %q, want %q", got, tt.want)
+				}
+
+				// The server is called by minio client ComposeObject
+				if backend == "server" {
+					return
+				}
+				n, want := composer.composed.Load()-composed, int32(1)
+				if tt.err != nil {
+					want = 0
+				}
+				if n != want {
+					t.Fatalf("got %d ComposeObject calls, want %d", n, want)
+				}
+			})
+		}
+	}
+}
+
+func TestCopyMetadata(t *testing.T) {
+	srcMeta := map[string]string{"A": "1", "B": "2"}
+	newMeta := map[string]string{"B": "3", "C": "4"}
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name  string
+		opt   func(etag string) *teos3.CopyOptions
+		meta  map[string]string // destination user metadata
+		ct    string            // destination content type
+		class string            // destination storage class
+		tags  map[string]string // destination tags
+		err   error
+	}{
+		{name: "copy", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{}
+		}, meta: srcMeta},
+		{name: "replace", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{Metadata: teos3.MetadataReplace,
+				UserMetadata: newMeta}
+		}, meta: newMeta},
+		{name: "merge", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{Metadata: teos3.MetadataMerge,
+				UserMetadata: newMeta}
+		}, meta: map[string]string{"A": "1", "B": "3", "C": "4"}},
+		{name: "content type", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{ContentType: "text/new"}
+		}, meta: srcMeta, ct: "text/new"},
+		{name: "storage class", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{StorageClass: "REDUCED_REDUNDANCY"}
+		}, meta: srcMeta, class: "REDUCED_REDUNDANCY"},
+		{name: "replace tags", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{ReplaceTags: true,
+				UserTags: map[string]string{"new": "1"}}
+		}, meta: srcMeta, tags: map[string]string{"new": "1"}},
+		{name: "match etag", opt: func(etag string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{MatchETag: etag}
+		}, meta: srcMeta},
+		{name: "match etag failed", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{MatchETag: "0123456789abcdef"}
+		}, err: teos3.ErrPreconditionFailed},
+		{name: "no match etag failed", opt: func(etag string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{NoMatchETag: etag}
+		}, err: teos3.ErrPreconditionFailed},
+		{name: "modified since failed", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{MatchModifiedSince: future}
+		}, err: teos3.ErrPreconditionFailed},
+		{name: "unmodified since failed", opt: func(string) *teos3.CopyOptions {
+			return &teos3.CopyOptions{MatchUnmodifiedSince: past}
+		}, err: teos3.ErrPreconditionFailed},
+	}
+
+	// The objects are copied on server side, streamed to another connection
+	// and copied onto itself
+	for backend, con := range connections(t, nil) {
+		for _, target := range []string{"server", "stream", "self"} {
+			for i, tt := range tests {
+				name := backend + "/" + target + "/" + tt.name
+				t.Run(name, func(t *testing.T) {
+					key := fmt.Sprintf("%s/%d/", target, i)
+					src, dst := con.WithPrefix(key), con.WithPrefix(key)
+					dstKey := "target"
+					switch target {
+					case "stream":
+						dst = teos3.ConnectMemory().WithPrefix(key)
+					case "self":
+						dstKey = "source"
+					}
+
+					opt := con.NewSetOptions()
+					opt.ContentType = "text/source"
+					opt.UserMetadata = srcMeta
+					opt.UserTags = map[string]string{"src": "1"}
+					err := src.Set("source", []byte("source"), opt)
+					if err != nil {
+						t.Fatal(err)
+					}
+					srcInfo, err := src.GetInfo("source")
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					copyOpt := tt.opt(srcInfo.ETag)
+					copyOpt.Overwrite = teos3.OverwriteAlways
+					err = src.CopyTo(dst, "source", dstKey, copyOpt)
+					if !errors.Is(err, tt.err) {
+						t.Fatalf("got error %v, want %v", err, tt.err)
+					}
+					info, err := dst.GetInfo(dstKey)
+					switch {
+					case tt.err != nil && target == "self":
+						return
+					case tt.err != nil && !errors.Is(err, teos3.ErrNotFound):
+						t.Fatalf("got target error %v, want %v", err,
+							teos3.ErrNotFound)
+					case tt.err != nil:
+						return
+					case err != nil:
+						t.Fatal(err)
+					}
+
+					// Check destination metadata. The minio client does not
+					// return storage class and tags in object info, so tags
+					// are counted and they are not streamed from server
+					ct, tags := tt.ct, tt.tags
+					if ct == "" {
+						ct = "text/source"
+					}
+					if tags == nil {
+						tags = map[string]string{"src": "1"}
+					}
+					tagCount := len(info.UserTags)
+					if tagCount == 0 {
+						tagCount = info.UserTagCount
+					}
+					if backend == "server" && target == "stream" &&
+						!tt.opt("").ReplaceTags {
+						tags = nil
+					}
+					switch {
+					case !maps.Equal(info.UserMetadata, tt.meta):
+						t.Fatalf("got metadata %v, want %v",
+							info.UserMetadata, tt.meta)
+					case info.ContentType != ct:
+						t.Fatalf("got content type %s, want %s",
+							info.ContentType, ct)
+					case backend != "server" && info.StorageClass != tt.class:
+						t.Fatalf("got storage class %s, want %s",
+							info.StorageClass, tt.class)
+					case tagCount != len(tags) || len(info.UserTags) > 0 &&
+						!maps.Equal(info.UserTags, tags):
+						t.Fatalf("got tags %v (%d), want %v", info.UserTags,
+							info.UserTagCount, tags)
+					}
+				})
+			}
+		}
+	}
+}
+
+// errRemove is the remove error of batchRemover backend bad object.
+var errRemove = minio.ErrorResponse{StatusCode: http.StatusForbidden,
+	Code: "AccessDenied", Message: "Remove denied."}
+
+// batchRemover is backend which records RemoveObjects batches sizes, fails
+// batches larger than S3 limit of 1000 keys and fails remove of 'bad'
+// objects.
+type batchRemover struct {
+	teos3.Backend
+	mut     sync.Mutex
+	batches []int
+}
+
+func (b *batchRemover) RemoveObject(ctx context.Context, bucket, key string,
+	opts minio.RemoveObjectOptions) error {
+
+	if path.Base(key) == "bad" {
+		return errRemove
+	}
+	return b.Backend.RemoveObject(ctx, bucket, key, opts)
+}
+
+func (b *batchRemover) RemoveObjects(ctx context.Context, bucket string,
+	objectsCh <-chan minio.ObjectInfo,
+	opts minio.RemoveObjectsOptions) <-chan minio.RemoveObjectError {
+
+	var objs []minio.ObjectInfo
+	for obj := range objectsCh {
+		objs = append(objs, obj)
+	}
+	b.mut.Lock()
+	b.batches = append(b.batches, len(objs))
+	b.mut.Unlock()
+
+	errCh := make(chan minio.RemoveObjectError, len(objs))
+	for _, obj := range objs {
+		err := error(errRemove)
+		if len(objs) <= 1000 {
+			err = b.RemoveObject(ctx, bucket, obj.Key,
+				minio.RemoveObjectOptions{})
+		}
+		if err != nil {
+			errCh <- minio.RemoveObjectError{ObjectName: obj.Key, Err: err}
+		}
+	}
+	close(errCh)
+	return errCh
+}
+
+// reset clears recorded batches sizes.
+func (b *batchRemover) reset() {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	b.batches = nil
+}
+
+// sizes returns recorded batches sizes.
+func (b *batchRemover) sizes() []int {
+	b.mut.Lock()
+	defer b.mut.Unlock()
+	return slices.Clone(b.batches)
+}
+
+func TestDelFolder(t *testing.T) {
+	tests := []struct {
+		name   string
+		keys   int // Number of removed folder objects
+		failed int // Number of not removed 'bad' folder objects, 0 or 1
+	}{
+		{"empty", 0, 0},
+		{"one batch", 10, 0},
+		{"full batch", 1000, 0},
+		{"several batches", 2001, 0},
+		{"failed object", 10, 1},
+	}
+
+	removers := make(map[string]*batchRemover)
+	wrap := func(name string, b teos3.Backend) teos3.Backend {
+		removers[name] = &batchRemover{Backend: b}
+		return removers[name]
+	}
+	for backend, con := range connections(t, wrap) {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				// Create folder objects and object outside folder
+				const folder = "folder/"
+				var wg sync.WaitGroup
+				var size int64
+				for i := range tt.keys {
+					key := fmt.Sprintf("%s%04d", folder, i)
+					size += int64(len(key))
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if err := con.Set(key, []byte(key)); err != nil {
+							t.Error(err)
+						}
+					}()
+				}
+				wg.Wait()
+				if tt.failed > 0 {
+					set(t, con, folder+"bad")
+				}
+				set(t, con, "folder.txt")
+				removers[backend].reset()
+
+				var sum teos3.Summary
+				err := con.Del(folder, &teos3.DelOptions{Summary: &sum})
+				switch {
+				case tt.failed == 0 && err != nil:
+					t.Fatal(err)
+				case tt.failed > 0 && !errors.Is(err, teos3.ErrAccessDenied):
+					t.Fatalf("got error %v, want %v", err,
+						teos3.ErrAccessDenied)
+				}
+
+				// Check summary and removed objects
+				if sum.Objects != int64(tt.keys) || sum.Bytes != size ||
+					len(sum.Failed) != tt.failed {
+					t.Fatalf("got summary %d objects, %d bytes, %d failed, "+
+						"want %d, %d, %d", sum.Objects, sum.Bytes,
+						len(sum.Failed), tt.keys, size, tt.failed)
+				}
+				if tt.failed > 0 && sum.Failed[0].Key != folder+"bad" {
+					t.Fatalf("got failed key %s", sum.Failed[0].Key)
+				}
+				keys, err := con.ListArErr("", &teos3.ListOptions{
+					ListObjectsOptions: teos3.ListObjectsOptions{
+						Recursive: true,
+					},
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := []string{"folder.txt"}
+				if tt.failed > 0 {
+					want = append(want, folder+"bad")
+				}
+				if !slices.Equal(keys, want) {
+					t.Fatalf("got keys %v after Del, want %v", keys, want)
+				}
+
+				// Check batches of local backends, the server removes
+				// objects one by one
+				if backend == "server" {
+					return
+				}
+				var n int
+				sizes := removers[backend].sizes()
+				for _, b := range sizes {
+					n += b
+				}
+				batches := (tt.keys + tt.failed + 999) / 1000
+				if n != tt.keys+tt.failed || len(sizes) != batches {
+					t.Fatalf("got batches %v", sizes)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The teos3test package AWS Signature Version 4 module.
+
+package teos3test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/s3utils"
+)
+
+// Signature V4 constants
+const (
+	signV4Algorithm    = "AWS4-HMAC-SHA256"
+	streamingPrefix    = "STREAMING-"
+	streamingChunkHdr  = "AWS4-HMAC-SHA256-PAYLOAD"
+	unsignedPayload    = "UNSIGNED-PAYLOAD"
+	emptySHA256        = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	chunkSignatureName = ";chunk-signature="
+)
+
+// Signature errors
+var (
+	errSignatureDoesNotMatch = apiError(http.StatusForbidden,
+		"SignatureDoesNotMatch", "The request signature we calculated does "+
+			"not match the signature you provided.")
+	errInvalidAccessKeyID = apiError(http.StatusForbidden,
+		"InvalidAccessKeyId", "The Access Key Id you provided does not exist "+
+			"in our records.")
+	errAuthorizationHeaderMalformed = apiError(http.StatusBadRequest,
+		"AuthorizationHeaderMalformed", "The authorization header is "+
+			"malformed.")
+	errContentSHA256Mismatch = apiError(http.StatusBadRequest,
+		"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' "+
+			"header does not match what was computed.")
+	errIncompleteBody = apiError(http.StatusBadRequest, "IncompleteBody",
+		"You did not provide the number of bytes specified by the "+
+			"Content-Length HTTP header.")
+)
+
+// signature contains parsed Authorization header.
+type signature struct {
+	accessKey     string
+	date          string
+	scope         string
+	signedHeaders []string
+	signature     string
+}
+
+// authenticate checks request signature and returns request body. Streaming
+// (aws-chunked) body is decoded and its chunks signatures are checked.
+func (s *Server) authenticate(r *http.Request) (body []byte, err error) {
+
+	// Anonymous requests are not allowed
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		err = errAccessDenied
+		return
+	}
+
+	sig, err := parseAuthorization(auth)
+	if err != nil {
+		return
+	}
+	if sig.accessKey != s.AccessKey {
+		err = errInvalidAccessKeyID
+		return
+	}
+	sig.date = r.Header.Get("X-Amz-Date")
+
+	// Check request signature
+	key := signingKey(s.SecretKey, sig.scope)
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+	}
+	stringToSign := signV4Algorithm + "\n" + sig.date + "\n" + sig.scope +
+		"\n" + sha256Hex([]byte(canonicalRequest(r, sig.signedHeaders,
+		payloadHash)))
+	if !hmac.Equal([]byte(hmacHex(key, stringToSign)), []byte(sig.signature)) {
+		err = errSignatureDoesNotMatch
+		return
+	}
+
+	// Read body
+	if r.Body == nil {
+		return
+	}
+	if body, err = io.ReadAll(r.Body); err != nil {
+		return
+	}
+
+	// Check payload
+	switch {
+	case strings.HasPrefix(payloadHash, streamingPrefix):
+		body, err = decodeChunked(body, key, sig)
+		if err != nil {
+			return
+		}
+		if l := r.Header.Get("X-Amz-Decoded-Content-Length"); l != "" &&
+			l != strconv.Itoa(len(body)) {
+			err = errIncompleteBody
+		}
+	case payloadHash != unsignedPayload:
+		if sha256Hex(body) != payloadHash {
+			err = errContentSHA256Mismatch
+		}
+	}
+
+	return
+}
+
+// parseAuthorization parses Authorization header.
+func parseAuthorization(auth string) (sig signature, err error) {
+	err = errAuthorizationHeaderMalformed
+
+	fields, ok := strings.CutPrefix(auth, signV4Algorithm+" ")
+	if !ok {
+		return
+	}
+	for _, field := range strings.Split(fields, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "Credential":
+			var ok bool
+			sig.accessKey, sig.scope, ok = strings.Cut(value, "/")
+			if !ok {
+				return
+			}
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(value, ";")
+		case "Signature":
+			sig.signature = value
+		}
+	}
+	if sig.scope == "" || sig.signature == "" || len(sig.signedHeaders) == 0 {
+		return
+	}
+
+	err = nil
+	return
+}
+
+// canonicalRequest returns Signature V4 canonical request.
+func canonicalRequest(r *http.Request, signedHeaders []string,
+	payloadHash string) string {
+
+	// Canonical headers
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := r.Host
+		if name != "host" {
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+
+	// Canonical query
+	query := strings.ReplaceAll(r.URL.Query().Encode(), "+", "%20")
+
+	return strings.Join([]string{
+		r.Method,
+		s3utils.EncodePath(r.URL.Path),
+		query,
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// decodeChunked decodes aws-chunked body and checks chunks signatures.
+func decodeChunked(body, key []byte, sig signature) (data []byte, err error) {
+	reader := bufio.NewReader(bytes.NewReader(body))
+	prevSignature := sig.signature
+
+	for {
+		// Read chunk header: hex-size[;chunk-signature=signature]
+		var line string
+		line, err = reader.ReadString('\n')
+		if err != nil {
+			err = errIncompleteBody
+			return
+		}
+		sizeStr, chunkSignature, signed := strings.Cut(
+			strings.TrimRight(line, "\r\n"), chunkSignatureName)
+		var size int64
+		size, err = strconv.ParseInt(sizeStr, 16, 64)
+		if err != nil {
+			err = errIncompleteBody
+			return
+		}
+
+		// Read chunk data
+		chunk := make([]byte, size)
+		if _, err = io.ReadFull(reader, chunk); err != nil {
+			err = errIncompleteBody
+			return
+		}
+
+		// Check chunk signature
+		if signed {
+			stringToSign := streamingChunkHdr + "\n" + sig.date + "\n" +
+				sig.scope + "\n" + prevSignature + "\n" + emptySHA256 + "\n" +
+				sha256Hex(chunk)
+			if !hmac.Equal([]byte(hmacHex(key, stringToSign)),
+				[]byte(chunkSignature)) {
+				err = errSignatureDoesNotMatch
+				return
+			}
+			prevSignature = chunkSignature
+		}
+
+		// The last chunk may be followed by trailing headers
+		if size == 0 {
+			return
+		}
+		data = append(data, chunk...)
+
+		if _, err = reader.Discard(2); err != nil {
+			err = errIncompleteBody
+			return
+		}
+	}
+}
+
+// signingKey returns Signature V4 signing key of scope.
+func signingKey(secretKey, scope string) (key []byte) {
+	key = []byte("AWS4" + secretKey)
+	for _, part := range strings.Split(scope, "/") {
+		key = hmacSum(key, part)
+	}
+	return
+}
+
+// hmacSum returns HMAC-SHA256 of data.
+func hmacSum(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// hmacHex returns hex encoded HMAC-SHA256 of data.
+func hmacHex(key []byte, data string) string {
+	return hex.EncodeToString(hmacSum(key, data))
+}
+
+// sha256Hex returns hex encoded SHA256 of data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
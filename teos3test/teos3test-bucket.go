@@ -0,0 +1,111 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The teos3test package buckets module.
+
+package teos3test
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Buckets XML requests and responses
+type (
+	createBucketConfiguration struct {
+		XMLName  xml.Name `xml:"CreateBucketConfiguration"`
+		Location string   `xml:"LocationConstraint"`
+	}
+
+	listBucket struct {
+		Name         string
+		CreationDate string
+	}
+
+	listAllMyBucketsResult struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Owner   struct {
+			ID          string
+			DisplayName string
+		}
+		Buckets []listBucket `xml:"Buckets>Bucket"`
+	}
+)
+
+// listBuckets serves ListBuckets request.
+func (s *Server) listBuckets(w http.ResponseWriter, r *http.Request) error {
+
+	buckets, err := s.backend.ListBuckets(r.Context())
+	if err != nil {
+		return err
+	}
+
+	var result listAllMyBucketsResult
+	result.Owner.ID = s.AccessKey
+	result.Owner.DisplayName = s.AccessKey
+	for _, bucket := range buckets {
+		result.Buckets = append(result.Buckets, listBucket{
+			Name:         bucket.Name,
+			CreationDate: bucket.CreationDate.UTC().Format(timeFormat),
+		})
+	}
+
+	return writeXML(w, http.StatusOK, result)
+}
+
+// headBucket serves HeadBucket request.
+func (s *Server) headBucket(w http.ResponseWriter, r *http.Request,
+	bucket string) error {
+
+	ok, err := s.backend.BucketExists(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apiError(http.StatusNotFound, "NoSuchBucket",
+			"The specified bucket does not exist.")
+	}
+
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// makeBucket serves CreateBucket request.
+func (s *Server) makeBucket(w http.ResponseWriter, r *http.Request,
+	bucket string, body []byte) error {
+
+	var opts minio.MakeBucketOptions
+	if len(body) > 0 {
+		var config createBucketConfiguration
+		if err := xml.Unmarshal(body, &config); err != nil {
+			return apiError(http.StatusBadRequest, "MalformedXML",
+				"The XML you provided was not well-formed.")
+		}
+		opts.Region = config.Location
+	}
+
+	err := s.backend.MakeBucket(r.Context(), bucket, opts)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// removeBucket serves DeleteBucket request.
+func (s *Server) removeBucket(w http.ResponseWriter, r *http.Request,
+	bucket string) error {
+
+	err := s.backend.RemoveBucket(r.Context(), bucket)
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,79 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The teos3test package multi-object delete module.
+
+package teos3test
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// maxDeleteObjects is the maximum number of objects in DeleteObjects request.
+const maxDeleteObjects = 1000
+
+// Multi-object delete XML requests and responses
+type (
+	deleteObject struct {
+		Key       string
+		VersionID string `xml:"VersionId,omitempty"`
+	}
+
+	deleteRequest struct {
+		XMLName xml.Name `xml:"Delete"`
+		Quiet   bool
+		Objects []deleteObject `xml:"Object"`
+	}
+
+	deleteError struct {
+		Key       string
+		VersionID string `xml:"VersionId,omitempty"`
+		Code      string
+		Message   string
+	}
+
+	deleteResult struct {
+		XMLName xml.Name       `xml:"DeleteResult"`
+		Deleted []deleteObject `xml:"Deleted"`
+		Errors  []deleteError  `xml:"Error"`
+	}
+)
+
+// deleteObjects serves DeleteObjects request.
+func (s *Server) deleteObjects(w http.ResponseWriter, r *http.Request,
+	bucket string, body []byte) error {
+
+	var request deleteRequest
+	if err := xml.Unmarshal(body, &request); err != nil ||
+		len(request.Objects) == 0 || len(request.Objects) > maxDeleteObjects {
+		return errMalformedXML
+	}
+
+	var result deleteResult
+	for _, obj := range request.Objects {
+		err := s.backend.RemoveObject(r.Context(), bucket, obj.Key,
+			minio.RemoveObjectOptions{VersionID: obj.VersionID})
+		if err != nil {
+			errResp := minio.ToErrorResponse(err)
+			if errResp.Code == "" {
+				errResp.Code, errResp.Message = "InternalError", err.Error()
+			}
+			result.Errors = append(result.Errors, deleteError{
+				Key:       obj.Key,
+				VersionID: obj.VersionID,
+				Code:      errResp.Code,
+				Message:   errResp.Message,
+			})
+			continue
+		}
+		if !request.Quiet {
+			result.Deleted = append(result.Deleted, obj)
+		}
+	}
+
+	return writeXML(w, http.StatusOK, result)
+}
@@ -0,0 +1,242 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The teos3test package list objects module.
+
+package teos3test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// maxKeys is default and maximum number of keys in list response.
+const maxKeys = 1000
+
+// List objects XML responses
+type (
+	listObjectsContent struct {
+		Key          string
+		LastModified string
+		ETag         string
+		Size         int64
+		StorageClass string
+	}
+
+	listCommonPrefix struct {
+		Prefix string
+	}
+
+	listBucketResult struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		Marker         string
+		NextMarker     string `xml:",omitempty"`
+		MaxKeys        int
+		Delimiter      string
+		IsTruncated    bool
+		Contents       []listObjectsContent
+		CommonPrefixes []listCommonPrefix
+	}
+
+	listBucketV2Result struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		StartAfter            string `xml:",omitempty"`
+		ContinuationToken     string `xml:",omitempty"`
+		NextContinuationToken string `xml:",omitempty"`
+		KeyCount              int
+		MaxKeys               int
+		Delimiter             string
+		IsTruncated           bool
+		Contents              []listObjectsContent
+		CommonPrefixes        []listCommonPrefix
+	}
+)
+
+// listPage contains one page of objects list.
+type listPage struct {
+	contents       []listObjectsContent
+	commonPrefixes []listCommonPrefix
+	isTruncated    bool
+	lastKey        string
+}
+
+// listObjectsV1 serves ListObjects request.
+func (s *Server) listObjectsV1(w http.ResponseWriter, r *http.Request,
+	bucket string, query url.Values) error {
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	marker := query.Get("marker")
+	max, err := listMaxKeys(query)
+	if err != nil {
+		return err
+	}
+
+	page, err := s.listPage(r.Context(), bucket, prefix, delimiter, marker, max)
+	if err != nil {
+		return err
+	}
+
+	result := listBucketResult{
+		Name:           bucket,
+		Prefix:         prefix,
+		Marker:         marker,
+		MaxKeys:        max,
+		Delimiter:      delimiter,
+		IsTruncated:    page.isTruncated,
+		Contents:       page.contents,
+		CommonPrefixes: page.commonPrefixes,
+	}
+	if page.isTruncated {
+		result.NextMarker = page.lastKey
+	}
+
+	return writeXML(w, http.StatusOK, result)
+}
+
+// listObjectsV2 serves ListObjectsV2 request.
+func (s *Server) listObjectsV2(w http.ResponseWriter, r *http.Request,
+	bucket string, query url.Values) error {
+
+	prefix := query.Get("prefix")
+	delimiter := query.Get("delimiter")
+	startAfter := query.Get("start-after")
+	token := query.Get("continuation-token")
+	max, err := listMaxKeys(query)
+	if err != nil {
+		return err
+	}
+
+	// Continuation token contains last listed key
+	after := startAfter
+	if token != "" {
+		data, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return apiError(http.StatusBadRequest, "InvalidArgument",
+				"The continuation token provided is incorrect")
+		}
+		after = string(data)
+	}
+
+	page, err := s.listPage(r.Context(), bucket, prefix, delimiter, after, max)
+	if err != nil {
+		return err
+	}
+
+	result := listBucketV2Result{
+		Name:              bucket,
+		Prefix:            prefix,
+		StartAfter:        startAfter,
+		ContinuationToken: token,
+		KeyCount:          len(page.contents) + len(page.commonPrefixes),
+		MaxKeys:           max,
+		Delimiter:         delimiter,
+		IsTruncated:       page.isTruncated,
+		Contents:          page.contents,
+		CommonPrefixes:    page.commonPrefixes,
+	}
+	if page.isTruncated {
+		result.NextContinuationToken = base64.RawURLEncoding.EncodeToString(
+			[]byte(page.lastKey))
+	}
+
+	return writeXML(w, http.StatusOK, result)
+}
+
+// listPage returns one page of objects list with up to max keys listed after
+// the after key.
+func (s *Server) listPage(ctx context.Context, bucket, prefix, delimiter,
+	after string, max int) (page listPage, err error) {
+
+	if delimiter != "" && delimiter != "/" {
+		err = errNotImplemented
+		return
+	}
+	if max == 0 {
+		return
+	}
+
+	// The list continues after all keys of common prefix if the after key
+	// is a common prefix
+	if delimiter != "" && strings.HasPrefix(after, prefix) &&
+		strings.HasSuffix(after[len(prefix):], delimiter) {
+		after += "\xff"
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	objInfo := s.backend.ListObjects(ctx, bucket, minio.ListObjectsOptions{
+		Prefix:     prefix,
+		StartAfter: after,
+		Recursive:  delimiter == "",
+	})
+
+	for obj := range objInfo {
+		if obj.Err != nil {
+			err = obj.Err
+			return
+		}
+
+		// Page is full
+		if len(page.contents)+len(page.commonPrefixes) >= max {
+			page.isTruncated = true
+			return
+		}
+
+		// Folders keys are common prefixes
+		page.lastKey = obj.Key
+		if delimiter != "" && strings.Contains(obj.Key[len(prefix):], delimiter) {
+			page.commonPrefixes = append(page.commonPrefixes,
+				listCommonPrefix{obj.Key})
+			continue
+		}
+
+		page.contents = append(page.contents, listObjectsContent{
+			Key:          obj.Key,
+			LastModified: httpTime(obj.LastModified),
+			ETag:         etag(obj.ETag),
+			Size:         obj.Size,
+			StorageClass: storageClass(obj.StorageClass),
+		})
+	}
+
+	return
+}
+
+// listMaxKeys returns max-keys query parameter value.
+func listMaxKeys(query url.Values) (max int, err error) {
+	max = maxKeys
+	if v := query.Get("max-keys"); v != "" {
+		max, err = strconv.Atoi(v)
+		if err != nil || max < 0 {
+			err = apiError(http.StatusBadRequest, "InvalidArgument",
+				"Argument maxKeys must be an integer between 0 and 2147483647")
+			return
+		}
+		if max > maxKeys {
+			max = maxKeys
+		}
+	}
+	return
+}
+
+// storageClass returns object storage class or default STANDARD class.
+func storageClass(class string) string {
+	if class == "" {
+		return "STANDARD"
+	}
+	return class
+}
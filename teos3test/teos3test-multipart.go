@@ -0,0 +1,357 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The teos3test package multipart upload module.
+
+package teos3test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// upload is multipart upload.
+type upload struct {
+	bucket    string
+	key       string
+	opts      minio.PutObjectOptions
+	parts     map[int][]byte
+	initiated time.Time
+}
+
+// Multipart upload XML requests and responses
+type (
+	initiateMultipartUploadResult struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Bucket   string
+		Key      string
+		UploadID string `xml:"UploadId"`
+	}
+
+	completeMultipartUpload struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}
+
+	copyPartResult struct {
+		XMLName      xml.Name `xml:"CopyPartResult"`
+		ETag         string
+		LastModified string
+	}
+
+	completeMultipartUploadResult struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Location string
+		Bucket   string
+		Key      string
+		ETag     string
+	}
+
+	listMultipartUploadsUpload struct {
+		Key          string
+		UploadID     string `xml:"UploadId"`
+		Initiated    string
+		StorageClass string
+	}
+
+	listMultipartUploadsResult struct {
+		XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+		Bucket      string
+		Prefix      string
+		MaxUploads  int
+		IsTruncated bool
+		Uploads     []listMultipartUploadsUpload `xml:"Upload"`
+	}
+)
+
+// Multipart upload errors
+var (
+	errNoSuchUpload = apiError(http.StatusNotFound, "NoSuchUpload",
+		"The specified multipart upload does not exist.")
+	errInvalidPart = apiError(http.StatusBadRequest, "InvalidPart",
+		"One or more of the specified parts could not be found.")
+	errInvalidPartOrder = apiError(http.StatusBadRequest, "InvalidPartOrder",
+		"The list of parts was not in ascending order.")
+	errMalformedXML = apiError(http.StatusBadRequest, "MalformedXML",
+		"The XML you provided was not well-formed or did not validate "+
+			"against our published schema.")
+)
+
+// newMultipartUpload serves CreateMultipartUpload request.
+func (s *Server) newMultipartUpload(w http.ResponseWriter, r *http.Request,
+	bucket, key string) error {
+
+	opts, err := putObjectOptions(r.Header)
+	if err != nil {
+		return err
+	}
+
+	s.mut.Lock()
+	s.uploadID++
+	uploadID := strconv.FormatInt(s.uploadID, 10)
+	s.uploads[uploadID] = &upload{
+		bucket:    bucket,
+		key:       key,
+		opts:      opts,
+		parts:     make(map[int][]byte),
+		initiated: time.Now(),
+	}
+	s.mut.Unlock()
+
+	return writeXML(w, http.StatusOK, initiateMultipartUploadResult{
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: uploadID,
+	})
+}
+
+// uploadPart serves UploadPart request.
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request,
+	bucket, key string, query url.Values, body []byte) error {
+
+	partNumber, err := partNumber(query)
+	if err != nil {
+		return err
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	upload, err := s.upload(bucket, key, query)
+	if err != nil {
+		return err
+	}
+	upload.parts[partNumber] = body
+
+	w.Header().Set("ETag", etag(md5Hex(body)))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// uploadPartCopy serves UploadPartCopy request.
+func (s *Server) uploadPartCopy(w http.ResponseWriter, r *http.Request,
+	bucket, key string, query url.Values) error {
+
+	partNumber, err := partNumber(query)
+	if err != nil {
+		return err
+	}
+	src, err := copySource(r.Header)
+	if err != nil {
+		return err
+	}
+
+	// Read source object range
+	obj, err := s.backend.GetObject(r.Context(), src.Bucket, src.Object,
+		minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		return err
+	}
+	start, length, err := copySourceRange(
+		r.Header.Get("X-Amz-Copy-Source-Range"), info.Size)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, length)
+	if _, err = io.ReadFull(io.NewSectionReader(obj, start, length),
+		data); err != nil {
+		return err
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	upload, err := s.upload(bucket, key, query)
+	if err != nil {
+		return err
+	}
+	upload.parts[partNumber] = data
+
+	return writeXML(w, http.StatusOK, copyPartResult{
+		ETag:         etag(md5Hex(data)),
+		LastModified: httpTime(info.LastModified),
+	})
+}
+
+// completeMultipartUpload serves CompleteMultipartUpload request.
+func (s *Server) completeMultipartUpload(w http.ResponseWriter,
+	r *http.Request, bucket, key string, query url.Values, body []byte) error {
+
+	var complete completeMultipartUpload
+	if err := xml.Unmarshal(body, &complete); err != nil ||
+		len(complete.Parts) == 0 {
+		return errMalformedXML
+	}
+
+	// Get upload and remove it from uploads
+	s.mut.Lock()
+	upload, err := s.upload(bucket, key, query)
+	if err == nil {
+		delete(s.uploads, query.Get("uploadId"))
+	}
+	s.mut.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// Join parts
+	var data []byte
+	for i, part := range complete.Parts {
+		if i > 0 && part.PartNumber <= complete.Parts[i-1].PartNumber {
+			return errInvalidPartOrder
+		}
+		partData, ok := upload.parts[part.PartNumber]
+		if !ok || etag(md5Hex(partData)) != etag(part.ETag) {
+			return errInvalidPart
+		}
+		data = append(data, partData...)
+	}
+
+	info, err := s.backend.PutObject(r.Context(), bucket, key,
+		bytes.NewReader(data), int64(len(data)), upload.opts)
+	if err != nil {
+		return err
+	}
+
+	return writeXML(w, http.StatusOK, completeMultipartUploadResult{
+		Location: s.URL + "/" + bucket + "/" + key,
+		Bucket:   bucket,
+		Key:      key,
+		ETag:     etag(info.ETag),
+	})
+}
+
+// abortMultipartUpload serves AbortMultipartUpload request.
+func (s *Server) abortMultipartUpload(w http.ResponseWriter, r *http.Request,
+	bucket, key string, query url.Values) error {
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	if _, err := s.upload(bucket, key, query); err != nil {
+		return err
+	}
+	delete(s.uploads, query.Get("uploadId"))
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// listMultipartUploads serves ListMultipartUploads request. All uploads of
+// the bucket with keys started from prefix query parameter are returned in
+// one response.
+func (s *Server) listMultipartUploads(w http.ResponseWriter, r *http.Request,
+	bucket string, query url.Values) error {
+
+	result := listMultipartUploadsResult{
+		Bucket:     bucket,
+		Prefix:     query.Get("prefix"),
+		MaxUploads: maxKeys,
+	}
+
+	s.mut.Lock()
+	for uploadID, upload := range s.uploads {
+		if upload.bucket != bucket ||
+			!strings.HasPrefix(upload.key, result.Prefix) {
+			continue
+		}
+		result.Uploads = append(result.Uploads, listMultipartUploadsUpload{
+			Key:          upload.key,
+			UploadID:     uploadID,
+			Initiated:    httpTime(upload.initiated),
+			StorageClass: "STANDARD",
+		})
+	}
+	s.mut.Unlock()
+
+	sort.Slice(result.Uploads, func(i, j int) bool {
+		if result.Uploads[i].Key != result.Uploads[j].Key {
+			return result.Uploads[i].Key < result.Uploads[j].Key
+		}
+		return result.Uploads[i].UploadID < result.Uploads[j].UploadID
+	})
+
+	return writeXML(w, http.StatusOK, result)
+}
+
+// partNumber returns partNumber query parameter.
+func partNumber(query url.Values) (partNumber int, err error) {
+	partNumber, err = strconv.Atoi(query.Get("partNumber"))
+	if err != nil || partNumber < 1 || partNumber > 10000 {
+		err = apiError(http.StatusBadRequest, "InvalidArgument",
+			"Part number must be an integer between 1 and 10000, inclusive")
+	}
+	return
+}
+
+// copySourceRange returns start and length of x-amz-copy-source-range header
+// value 'bytes=first-last'. The whole object range is returned if value is
+// empty.
+func copySourceRange(value string, size int64) (start, length int64,
+	err error) {
+
+	if value == "" {
+		return 0, size, nil
+	}
+
+	var end int64
+	first, last, ok := strings.Cut(strings.TrimPrefix(value, "bytes="), "-")
+	if ok {
+		start, err = strconv.ParseInt(first, 10, 64)
+	}
+	if ok && err == nil {
+		end, err = strconv.ParseInt(last, 10, 64)
+	}
+	switch {
+	case !ok || err != nil || !strings.HasPrefix(value, "bytes=") ||
+		start < 0 || end < start:
+		err = apiError(http.StatusBadRequest, "InvalidArgument",
+			"The x-amz-copy-source-range value must be of the form "+
+				"bytes=first-last where first and last are the zero-based "+
+				"offsets of the first and last bytes to copy")
+	case end >= size:
+		err = apiError(http.StatusBadRequest, "InvalidArgument",
+			"Range specified is not valid for source object of size: "+
+				strconv.FormatInt(size, 10))
+	}
+	length = end - start + 1
+	return
+}
+
+// upload returns multipart upload by uploadId query parameter. It should be
+// called under lock.
+func (s *Server) upload(bucket, key string, query url.Values) (*upload,
+	error) {
+
+	upload, ok := s.uploads[query.Get("uploadId")]
+	if !ok || upload.bucket != bucket || upload.key != key {
+		return nil, errNoSuchUpload
+	}
+	return upload, nil
+}
+
+// md5Hex returns hex encoded MD5 of data.
+func md5Hex(data []byte) string {
+	sum := md5.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,522 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+// The teos3test package contains S3 compatible test server which may be used
+// in integration tests of code which uses teos3 package, s3cp application or
+// minio-go client. The server speaks enough of the S3 REST protocol to be
+// used by minio-go client: PutObject, GetObject, HeadObject, DeleteObject,
+// DeleteObjects, ListObjects (V1 and V2), CopyObject, multipart uploads,
+// ListMultipartUploads and UploadPartCopy, ListBuckets, HeadBucket,
+// CreateBucket and DeleteBucket. All requests are checked with AWS Signature
+// Version 4, including streaming (aws-chunked) payload signatures.
+//
+// Usage example:
+//
+//	srv := teos3test.NewServer()
+//	defer srv.Close()
+//
+//	con, err := srv.Connect()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	err = con.Set("key", []byte("value"))
+package teos3test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/tags"
+	"github.com/teonet-go/teos3"
+)
+
+// Default test server credentials
+const (
+	AccessKey = "teos3test"
+	SecretKey = "teos3test-secret"
+)
+
+// Server is S3 compatible test server based on httptest.Server. Objects are
+// stored in teos3.Backend.
+type Server struct {
+	*httptest.Server
+
+	// Credentials which are accepted by server. Default credentials are
+	// AccessKey and SecretKey constants.
+	AccessKey string
+	SecretKey string
+
+	backend   teos3.Backend
+	requestID atomic.Int64
+
+	mut      sync.Mutex
+	uploads  map[string]*upload
+	uploadID int64
+}
+
+// NewServer starts and returns new test server which stores objects in
+// memory. The caller should call Close when finished, to shut it down.
+func NewServer() *Server {
+	return NewServerBackend(teos3.NewMemory())
+}
+
+// NewServerBackend starts and returns new test server which stores objects in
+// backend. The caller should call Close when finished, to shut it down.
+func NewServerBackend(backend teos3.Backend) *Server {
+	s := &Server{
+		AccessKey: AccessKey,
+		SecretKey: SecretKey,
+		backend:   backend,
+		uploads:   make(map[string]*upload),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Endpoint returns server endpoint without http prefix which may be used in
+// teos3.Connect.
+func (s *Server) Endpoint() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+// Backend returns server storage backend.
+func (s *Server) Backend() teos3.Backend { return s.backend }
+
+// Connect creates new TeoS3 object connected to the server with bucket (if
+// omitted then default 'teos3' buckets name used).
+func (s *Server) Connect(buckets ...string) (*teos3.TeoS3, error) {
+	return teos3.Connect(s.AccessKey, s.SecretKey, s.Endpoint(), false,
+		buckets...)
+}
+
+// serveHTTP is the server requests handler.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Amz-Request-Id",
+		strconv.FormatInt(s.requestID.Add(1), 10))
+	w.Header().Set("Server", "teos3test")
+
+	// Check request signature and read body
+	body, err := s.authenticate(r)
+	if err == nil {
+		err = checkContentMD5(r, body)
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+		return
+	}
+
+	// Path style requests: /bucket/key
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	query := r.URL.Query()
+
+	switch {
+	case bucket == "" && r.Method == http.MethodGet:
+		err = s.listBuckets(w, r)
+	case bucket == "":
+		err = errNotImplemented
+	case key == "":
+		err = s.serveBucket(w, r, bucket, query, body)
+	default:
+		err = s.serveObject(w, r, bucket, key, query, body)
+	}
+	if err != nil {
+		s.writeError(w, r, err)
+	}
+}
+
+// serveBucket serves bucket requests.
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request,
+	bucket string, query url.Values, body []byte) error {
+
+	switch {
+	case r.Method == http.MethodHead:
+		return s.headBucket(w, r, bucket)
+	case r.Method == http.MethodPut && len(query) == 0:
+		return s.makeBucket(w, r, bucket, body)
+	case r.Method == http.MethodDelete && len(query) == 0:
+		return s.removeBucket(w, r, bucket)
+	case r.Method == http.MethodPost && query.Has("delete"):
+		return s.deleteObjects(w, r, bucket, body)
+	case r.Method == http.MethodGet && query.Has("uploads"):
+		return s.listMultipartUploads(w, r, bucket, query)
+	case r.Method == http.MethodGet && query.Has("location"):
+		return writeXML(w, http.StatusOK, locationConstraint{})
+	case r.Method == http.MethodGet && query.Get("list-type") == "2":
+		return s.listObjectsV2(w, r, bucket, query)
+	case r.Method == http.MethodGet:
+		return s.listObjectsV1(w, r, bucket, query)
+	}
+	return errNotImplemented
+}
+
+// serveObject serves object requests.
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request,
+	bucket, key string, query url.Values, body []byte) error {
+
+	switch r.Method {
+	case http.MethodGet:
+		return s.getObject(w, r, bucket, key)
+	case http.MethodHead:
+		return s.headObject(w, r, bucket, key)
+	case http.MethodPut:
+		switch {
+		case query.Has("uploadId") &&
+			r.Header.Get("X-Amz-Copy-Source") != "":
+			return s.uploadPartCopy(w, r, bucket, key, query)
+		case query.Has("uploadId"):
+			return s.uploadPart(w, r, bucket, key, query, body)
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			return s.copyObject(w, r, bucket, key)
+		}
+		return s.putObject(w, r, bucket, key, body)
+	case http.MethodPost:
+		switch {
+		case query.Has("uploads"):
+			return s.newMultipartUpload(w, r, bucket, key)
+		case query.Has("uploadId"):
+			return s.completeMultipartUpload(w, r, bucket, key, query, body)
+		}
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			return s.abortMultipartUpload(w, r, bucket, key, query)
+		}
+		return s.deleteObject(w, r, bucket, key)
+	}
+	return errNotImplemented
+}
+
+// getObject serves GetObject request.
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request,
+	bucket, key string) error {
+
+	obj, err := s.backend.GetObject(r.Context(), bucket, key,
+		minio.GetObjectOptions{})
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	info, err := obj.Stat()
+	if err != nil {
+		return err
+	}
+
+	// The ServeContent processes Range and conditional headers
+	setObjectHeaders(w, info)
+	http.ServeContent(w, r, "", info.LastModified, obj)
+	return nil
+}
+
+// headObject serves HeadObject request.
+func (s *Server) headObject(w http.ResponseWriter, r *http.Request,
+	bucket, key string) error {
+
+	info, err := s.backend.StatObject(r.Context(), bucket, key,
+		minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+
+	setObjectHeaders(w, info)
+	w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// putObject serves PutObject request.
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request,
+	bucket, key string, body []byte) error {
+
+	opts, err := putObjectOptions(r.Header)
+	if err != nil {
+		return err
+	}
+
+	info, err := s.backend.PutObject(r.Context(), bucket, key,
+		bytes.NewReader(body), int64(len(body)), opts)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("ETag", etag(info.ETag))
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// deleteObject serves DeleteObject request.
+func (s *Server) deleteObject(w http.ResponseWriter, r *http.Request,
+	bucket, key string) error {
+
+	err := s.backend.RemoveObject(r.Context(), bucket, key,
+		minio.RemoveObjectOptions{})
+	if err != nil {
+		return err
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// copyObject serves CopyObject request.
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request,
+	bucket, key string) error {
+
+	src, err := copySource(r.Header)
+	if err != nil {
+		return err
+	}
+
+	dst := minio.CopyDestOptions{Bucket: bucket, Object: key}
+	if strings.EqualFold(r.Header.Get("X-Amz-Metadata-Directive"), "REPLACE") {
+		opts, err := putObjectOptions(r.Header)
+		if err != nil {
+			return err
+		}
+		dst.ReplaceMetadata = true
+		dst.UserMetadata = make(map[string]string)
+		for k, v := range opts.UserMetadata {
+			dst.UserMetadata[k] = v
+		}
+		if opts.ContentType != "" {
+			dst.UserMetadata["Content-Type"] = opts.ContentType
+		}
+		if opts.StorageClass != "" {
+			dst.UserMetadata["X-Amz-Storage-Class"] = opts.StorageClass
+		}
+	}
+	if strings.EqualFold(r.Header.Get("X-Amz-Tagging-Directive"), "REPLACE") {
+		opts, err := putObjectOptions(r.Header)
+		if err != nil {
+			return err
+		}
+		dst.ReplaceTags = true
+		dst.UserTags = opts.UserTags
+	}
+
+	// Copy object with destination preconditions
+	var info minio.UploadInfo
+	ifMatch := strings.Trim(r.Header.Get("If-Match"), `"`)
+	ifNoneMatch := strings.Trim(r.Header.Get("If-None-Match"), `"`)
+	switch copier, ok := s.backend.(teos3.ConditionalCopier); {
+	case ok:
+		info, err = copier.CopyObjectIf(r.Context(), dst, src, ifMatch,
+			ifNoneMatch)
+	case ifMatch != "" || ifNoneMatch != "":
+		err = apiError(http.StatusNotImplemented, "NotImplemented",
+			"Conditional copy is not supported by backend.")
+	default:
+		info, err = s.backend.CopyObject(r.Context(), dst, src)
+	}
+	if err != nil {
+		return err
+	}
+
+	return writeXML(w, http.StatusOK, copyObjectResult{
+		ETag:         etag(info.ETag),
+		LastModified: httpTime(info.LastModified),
+	})
+}
+
+// copySource returns copy source options from request headers.
+func copySource(header http.Header) (src minio.CopySrcOptions, err error) {
+	source, err := url.PathUnescape(header.Get("X-Amz-Copy-Source"))
+	if err != nil {
+		return
+	}
+	source, _, _ = strings.Cut(source, "?versionId=")
+
+	var ok bool
+	src.Bucket, src.Object, ok = strings.Cut(strings.TrimPrefix(source, "/"), "/")
+	if !ok || src.Bucket == "" || src.Object == "" {
+		err = apiError(http.StatusBadRequest, "InvalidArgument",
+			"Copy Source must mention the source bucket and key: "+
+				"sourcebucket/sourcekey.")
+		return
+	}
+
+	// Source preconditions
+	src.MatchETag = header.Get("X-Amz-Copy-Source-If-Match")
+	src.NoMatchETag = header.Get("X-Amz-Copy-Source-If-None-Match")
+	if v := header.Get("X-Amz-Copy-Source-If-Modified-Since"); v != "" {
+		src.MatchModifiedSince, _ = http.ParseTime(v)
+	}
+	if v := header.Get("X-Amz-Copy-Source-If-Unmodified-Since"); v != "" {
+		src.MatchUnmodifiedSince, _ = http.ParseTime(v)
+	}
+	return
+}
+
+// putObjectOptions returns put object options from request headers.
+func putObjectOptions(header http.Header) (opts minio.PutObjectOptions,
+	err error) {
+
+	opts.ContentType = header.Get("Content-Type")
+	opts.StorageClass = header.Get("X-Amz-Storage-Class")
+	if etag := header.Get("If-Match"); etag != "" {
+		opts.SetMatchETag(strings.Trim(etag, `"`))
+	}
+	if etag := header.Get("If-None-Match"); etag != "" {
+		opts.SetMatchETagExcept(strings.Trim(etag, `"`))
+	}
+
+	for k, v := range header {
+		if name, ok := strings.CutPrefix(k, "X-Amz-Meta-"); ok {
+			if opts.UserMetadata == nil {
+				opts.UserMetadata = make(map[string]string)
+			}
+			opts.UserMetadata[name] = v[0]
+		}
+	}
+
+	if tagging := header.Get("X-Amz-Tagging"); tagging != "" {
+		var t *tags.Tags
+		if t, err = tags.ParseObjectTags(tagging); err != nil {
+			err = apiError(http.StatusBadRequest, "InvalidTag", err.Error())
+			return
+		}
+		opts.UserTags = t.ToMap()
+	}
+
+	return
+}
+
+// setObjectHeaders sets object info response headers.
+func setObjectHeaders(w http.ResponseWriter, info minio.ObjectInfo) {
+	h := w.Header()
+	h.Set("ETag", etag(info.ETag))
+	h.Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	h.Set("Content-Type", info.ContentType)
+	h.Set("Accept-Ranges", "bytes")
+	for k, v := range info.UserMetadata {
+		h.Set("X-Amz-Meta-"+k, v)
+	}
+	if info.StorageClass != "" {
+		h.Set("X-Amz-Storage-Class", info.StorageClass)
+	}
+	if len(info.UserTags) > 0 {
+		h.Set("X-Amz-Tagging-Count", strconv.Itoa(len(info.UserTags)))
+	}
+}
+
+// timeFormat is S3 XML time format.
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// S3 XML responses
+type (
+	locationConstraint struct {
+		XMLName  xml.Name `xml:"LocationConstraint"`
+		Location string   `xml:",chardata"`
+	}
+
+	copyObjectResult struct {
+		XMLName      xml.Name `xml:"CopyObjectResult"`
+		ETag         string
+		LastModified string
+	}
+
+	errorResponse struct {
+		XMLName    xml.Name `xml:"Error"`
+		Code       string
+		Message    string
+		BucketName string `xml:",omitempty"`
+		Key        string `xml:",omitempty"`
+		Resource   string
+		RequestID  string `xml:"RequestId"`
+	}
+)
+
+// writeXML writes XML response.
+func writeXML(w http.ResponseWriter, status int, v any) error {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(xml.Header)+len(data)))
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+	return nil
+}
+
+// Server API errors
+var (
+	errNotImplemented = apiError(http.StatusNotImplemented, "NotImplemented",
+		"A header you provided implies functionality that is not implemented.")
+	errAccessDenied = apiError(http.StatusForbidden, "AccessDenied",
+		"Access Denied.")
+	errBadDigest = apiError(http.StatusBadRequest, "BadDigest",
+		"The Content-MD5 you specified did not match what we received.")
+)
+
+// checkContentMD5 returns BadDigest error if request has Content-MD5 header
+// which does not match body MD5.
+func checkContentMD5(r *http.Request, body []byte) error {
+	sum := r.Header.Get("Content-Md5")
+	if sum == "" {
+		return nil
+	}
+	md5sum := md5.Sum(body)
+	if sum != base64.StdEncoding.EncodeToString(md5sum[:]) {
+		return errBadDigest
+	}
+	return nil
+}
+
+// apiError creates S3 error response.
+func apiError(status int, code, message string) minio.ErrorResponse {
+	return minio.ErrorResponse{StatusCode: status, Code: code, Message: message}
+}
+
+// writeError writes S3 error response.
+func (s *Server) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	var errResp minio.ErrorResponse
+	switch {
+	case errors.As(err, &errResp) && errResp.StatusCode != 0:
+	case errors.Is(err, context.Canceled),
+		errors.Is(err, context.DeadlineExceeded):
+		errResp = apiError(499, "RequestCancelled", err.Error())
+	default:
+		errResp = apiError(http.StatusInternalServerError, "InternalError",
+			err.Error())
+	}
+
+	// The HEAD response has no body
+	if r.Method == http.MethodHead {
+		w.WriteHeader(errResp.StatusCode)
+		return
+	}
+
+	writeXML(w, errResp.StatusCode, errorResponse{
+		Code:       errResp.Code,
+		Message:    errResp.Message,
+		BucketName: errResp.BucketName,
+		Key:        errResp.Key,
+		Resource:   r.URL.Path,
+		RequestID:  w.Header().Get("X-Amz-Request-Id"),
+	})
+}
+
+// httpTime returns time formatted for S3 XML responses.
+func httpTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// etag returns quoted ETag.
+func etag(s string) string {
+	return `"` + strings.Trim(s, `"`) + `"`
+}
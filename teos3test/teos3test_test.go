@@ -0,0 +1,313 @@
+// Copyright 2022-2023 Kirill Scherba <kirill@scherba.ru>.  All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be
+// found in the LICENSE file.
+
+package teos3test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"path"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+	"github.com/teonet-go/teos3"
+)
+
+// testBucket is the bucket used by tests.
+const testBucket = "test"
+
+// newCore returns minio Core client of server with credentials.
+func newCore(t *testing.T, srv *Server, accessKey, secretKey string) (
+	core *minio.Core) {
+
+	t.Helper()
+
+	core, err := minio.NewCore(srv.Endpoint(), &minio.Options{
+		Creds: credentials.NewStaticV4(accessKey, secretKey, ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// makeBucket creates test bucket by core client or fails test.
+func makeBucket(t *testing.T, core *minio.Core) {
+	t.Helper()
+
+	err := core.MakeBucket(context.Background(), testBucket,
+		minio.MakeBucketOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+	makeBucket(t, newCore(t, srv, AccessKey, SecretKey))
+
+	tests := []struct {
+		name      string
+		accessKey string
+		secretKey string
+		code      string
+	}{
+		{"valid", AccessKey, SecretKey, ""},
+		{"wrong secret", AccessKey, "wrong", "SignatureDoesNotMatch"},
+		{"wrong access key", "wrong", SecretKey, "InvalidAccessKeyId"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core := newCore(t, srv, tt.accessKey, tt.secretKey)
+			_, err := core.PutObject(context.Background(), testBucket, "key",
+				bytes.NewReader([]byte("data")), 4, "", "",
+				minio.PutObjectOptions{})
+			if code := minio.ToErrorResponse(err).Code; code != tt.code {
+				t.Fatalf("got error code %q, want %q", code, tt.code)
+			}
+		})
+	}
+
+	// Anonymous request
+	resp, err := http.Get(srv.URL + "/" + testBucket + "/key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("got anonymous request status %d, want %d", resp.StatusCode,
+			http.StatusForbidden)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	parts := []string{"part 1,", "part 2,", "part 3"}
+
+	tests := []struct {
+		name     string
+		complete bool
+		want     string // object data, empty if object should not exist
+	}{
+		{"complete", true, "part 1,part 2,part 3"},
+		{"abort", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServer()
+			defer srv.Close()
+			core := newCore(t, srv, AccessKey, SecretKey)
+			makeBucket(t, core)
+			ctx := context.Background()
+
+			uploadID, err := core.NewMultipartUpload(ctx, testBucket, "key",
+				minio.PutObjectOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var complete []minio.CompletePart
+			for i, part := range parts {
+				objPart, err := core.PutObjectPart(ctx, testBucket, "key",
+					uploadID, i+1, bytes.NewReader([]byte(part)),
+					int64(len(part)), minio.PutObjectPartOptions{})
+				if err != nil {
+					t.Fatal(err)
+				}
+				complete = append(complete, minio.CompletePart{
+					PartNumber: objPart.PartNumber,
+					ETag:       objPart.ETag,
+				})
+			}
+
+			// The upload is listed before complete or abort
+			uploads, err := core.ListMultipartUploads(ctx, testBucket, "",
+				"", "", "", 0)
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case len(uploads.Uploads) != 1 ||
+				uploads.Uploads[0].UploadID != uploadID:
+				t.Fatalf("got uploads %v, want %s", uploads.Uploads,
+					uploadID)
+			}
+
+			if tt.complete {
+				_, err = core.CompleteMultipartUpload(ctx, testBucket, "key",
+					uploadID, complete, minio.PutObjectOptions{})
+			} else {
+				err = core.AbortMultipartUpload(ctx, testBucket, "key",
+					uploadID)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			uploads, err = core.ListMultipartUploads(ctx, testBucket, "",
+				"", "", "", 0)
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case len(uploads.Uploads) != 0:
+				t.Fatalf("got uploads %v, want none", uploads.Uploads)
+			}
+
+			reader, _, _, err := core.GetObject(ctx, testBucket, "key",
+				minio.GetObjectOptions{})
+			if err == nil {
+				var data []byte
+				data, err = io.ReadAll(reader)
+				reader.Close()
+				if err == nil && string(data) != tt.want {
+					t.Fatalf("got object %q, want %q", data, tt.want)
+				}
+			}
+			switch {
+			case tt.want != "" && err != nil:
+				t.Fatal(err)
+			case tt.want == "" &&
+				minio.ToErrorResponse(err).Code != "NoSuchKey":
+				t.Fatalf("got error %v, want NoSuchKey", err)
+			}
+		})
+	}
+}
+
+// failingRemover is backend which fails to remove objects with 'bad' name.
+type failingRemover struct{ teos3.Backend }
+
+func (b failingRemover) RemoveObject(ctx context.Context, bucket, key string,
+	opts minio.RemoveObjectOptions) error {
+
+	if path.Base(key) == "bad" {
+		return minio.ErrorResponse{StatusCode: http.StatusForbidden,
+			Code: "AccessDenied", Message: "Access Denied."}
+	}
+	return b.Backend.RemoveObject(ctx, bucket, key, opts)
+}
+
+// deleteObjects sends signed DeleteObjects request with keys and returns
+// response status and body.
+func deleteObjects(t *testing.T, srv *Server, quiet bool, keys ...string) (
+	status int, body []byte) {
+
+	t.Helper()
+
+	request := deleteRequest{Quiet: quiet}
+	for _, key := range keys {
+		request.Objects = append(request.Objects, deleteObject{Key: key})
+	}
+	data, err := xml.Marshal(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		srv.URL+"/"+testBucket+"?delete=", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	req.Header.Set("Content-Length", strconv.Itoa(len(data)))
+	req = signer.SignV4(*req, AccessKey, SecretKey, "", "us-east-1")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if body, err = io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, body
+}
+
+func TestDeleteObjects(t *testing.T) {
+	tests := []struct {
+		name    string
+		quiet   bool
+		keys    []string
+		status  int
+		deleted []string
+		errors  []string
+		remain  []string
+	}{
+		{name: "delete", keys: []string{"a", "b"}, status: http.StatusOK,
+			deleted: []string{"a", "b"}, remain: []string{"bad", "c"}},
+		{name: "quiet", quiet: true, keys: []string{"a", "b"},
+			status: http.StatusOK, remain: []string{"bad", "c"}},
+		{name: "error", keys: []string{"a", "bad"}, status: http.StatusOK,
+			deleted: []string{"a"}, errors: []string{"bad"},
+			remain: []string{"b", "bad", "c"}},
+		{name: "no keys", status: http.StatusBadRequest,
+			remain: []string{"a", "b", "bad", "c"}},
+		{name: "too many keys", keys: make([]string, maxDeleteObjects+1),
+			status: http.StatusBadRequest,
+			remain: []string{"a", "b", "bad", "c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := NewServerBackend(failingRemover{teos3.NewMemory()})
+			defer srv.Close()
+			con, err := srv.Connect(testBucket)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"a", "b", "bad", "c"} {
+				if err := con.Set(key, []byte(key)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			status, body := deleteObjects(t, srv, tt.quiet, tt.keys...)
+			if status != tt.status {
+				t.Fatalf("got status %d, want %d: %s", status, tt.status,
+					body)
+			}
+			if status == http.StatusOK {
+				var result deleteResult
+				if err := xml.Unmarshal(body, &result); err != nil {
+					t.Fatal(err)
+				}
+				var deleted, errors []string
+				for _, obj := range result.Deleted {
+					deleted = append(deleted, obj.Key)
+				}
+				for _, e := range result.Errors {
+					if e.Code != "AccessDenied" {
+						t.Fatalf("got %s error code %s, want AccessDenied",
+							e.Key, e.Code)
+					}
+					errors = append(errors, e.Key)
+				}
+				if !reflect.DeepEqual(deleted, tt.deleted) {
+					t.Fatalf("got deleted %v, want %v", deleted, tt.deleted)
+				}
+				if !reflect.DeepEqual(errors, tt.errors) {
+					t.Fatalf("got errors %v, want %v", errors, tt.errors)
+				}
+			}
+
+			remain, err := con.ListArErr("")
+			switch {
+			case err != nil:
+				t.Fatal(err)
+			case !reflect.DeepEqual(remain, tt.remain):
+				t.Fatalf("got objects %v, want %v", remain, tt.remain)
+			}
+		})
+	}
+}